@@ -2,9 +2,20 @@
 package path
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	cid "github.com/dms3-fs/go-cid"
 )
@@ -17,8 +28,102 @@ var (
 	// do not contain at least one component
 	ErrNoComponents = errors.New(
 		"path must contain at least one component")
+
+	// ErrBadName is returned when a name is neither a cid nor a
+	// plausible domain name
+	ErrBadName = errors.New("invalid 'dms3ns' name")
+
+	// ErrNotPrefix is returned when a path was expected to start with
+	// another one but doesn't
+	ErrNotPrefix = errors.New("path is not a prefix of the other")
+
+	// ErrNoSegments is returned when an operation needs a path with
+	// segments after its root
+	ErrNoSegments = errors.New("path has no segments after its root")
+
+	// ErrNonCanonicalCid is returned when parsing with RequireCanonicalCid
+	// a path whose root cid isn't written in its canonical string form
+	ErrNonCanonicalCid = errors.New("root cid is not in its canonical form")
+)
+
+// ErrIllegalCharacter is returned when a path contains a control character
+// (including the null byte), which are never valid in a dms3fs path.
+type ErrIllegalCharacter struct {
+	Char byte
+	Pos  int
+}
+
+// Error implements the Error interface for ErrIllegalCharacter.
+func (e ErrIllegalCharacter) Error() string {
+	return fmt.Sprintf("illegal character %q at position %d in path", e.Char, e.Pos)
+}
+
+var (
+	protocolsLk sync.RWMutex
+	// protocols holds the protocols accepted by ParsePath, mapped to whether
+	// the first component of their paths must be a cid.
+	protocols = map[string]bool{
+		"dms3fs": true,
+		"dms3ns": false,
+		"dms3ld": false, //TODO: make this smarter
+	}
 )
 
+// ErrInvalidSegment is returned when building a path from segments and one of
+// them is not acceptable.
+type ErrInvalidSegment struct {
+	Index   int
+	Segment string
+	Err     error
+}
+
+// Error implements the Error interface for ErrInvalidSegment.
+func (e ErrInvalidSegment) Error() string {
+	return fmt.Sprintf("invalid path segment %d (%q): %s", e.Index, e.Segment, e.Err)
+}
+
+// MaxSegmentLength is the length in bytes beyond which ParsePath and
+// ValidateSegment reject a path segment, as such segments are almost
+// certainly abuse or corruption. Zero or less means no limit.
+var MaxSegmentLength = 1024
+
+// ErrSegmentTooLong is returned for path segments longer than
+// MaxSegmentLength. Index is the position of the segment in Segments of the
+// parsed path; it is 0 when the segment was checked alone by
+// ValidateSegment.
+type ErrSegmentTooLong struct {
+	Index int
+	Len   int
+}
+
+// Error implements the Error interface for ErrSegmentTooLong.
+func (e ErrSegmentTooLong) Error() string {
+	return fmt.Sprintf("path segment %d is too long: %d bytes, at most %d allowed", e.Index, e.Len, MaxSegmentLength)
+}
+
+// ErrNotCidRooted is returned by CheckResolvable for paths of a protocol
+// which isn't resolved from a cid, like dms3ns paths.
+type ErrNotCidRooted struct {
+	Protocol string
+}
+
+// Error implements the Error interface for ErrNotCidRooted.
+func (e ErrNotCidRooted) Error() string {
+	return fmt.Sprintf("%s paths are not rooted at a cid", e.Protocol)
+}
+
+// ErrUnexpectedCodec is returned by FromCidExpectCodec for a cid whose codec
+// isn't the expected one.
+type ErrUnexpectedCodec struct {
+	Expected uint64
+	Actual   uint64
+}
+
+// Error implements the Error interface for ErrUnexpectedCodec.
+func (e ErrUnexpectedCodec) Error() string {
+	return fmt.Sprintf("expected a cid with codec 0x%x, got 0x%x", e.Expected, e.Actual)
+}
+
 // A Path represents an dms3fs content path:
 //   * /<cid>/path/to/file
 //   * /dms3fs/<cid>
@@ -40,6 +145,70 @@ func FromCid(c *cid.Cid) Path {
 	return Path("/dms3fs/" + c.String())
 }
 
+// FromCidExpectCodec is like FromCid, but fails with ErrUnexpectedCodec
+// when the codec of c isn't codec, e.g. to catch a UnixFS path rooted at a
+// raw block instead of a cid.DagProtobuf node.
+func FromCidExpectCodec(c *cid.Cid, codec uint64) (Path, error) {
+	if c.Type() != codec {
+		return "", ErrUnexpectedCodec{Expected: codec, Actual: c.Type()}
+	}
+	return FromCid(c), nil
+}
+
+// PathSet is a set of paths, e.g. the pinned ones.
+type PathSet interface {
+	// Has reports whether p is in the set.
+	Has(p Path) bool
+}
+
+// JoinCidAndRest returns the path to rest under the node with cid c, e.g. to
+// rebuild a path from what ResolveToLastNode returns. Empty components of
+// rest are skipped.
+func JoinCidAndRest(c *cid.Cid, rest []string) Path {
+	p := string(FromCid(c))
+	for _, s := range rest {
+		if s != "" {
+			p += "/" + s
+		}
+	}
+	return Path(p)
+}
+
+// FromName safely converts a name, either a domain name (as used by
+// DNSLink) or a cid, to a /dms3ns/ Path.
+func FromName(name string) (Path, error) {
+	if !isDomainName(name) {
+		if _, err := cid.Decode(name); err != nil {
+			return "", ErrBadName
+		}
+	}
+	return Path("/dms3ns/" + name), nil
+}
+
+// isDomainName reports whether s is a syntactically valid domain name:
+// dot separated labels of letters, digits and hyphens which do not start or
+// end with a hyphen.
+func isDomainName(s string) bool {
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Segments returns the different elements of a path
 // (elements are delimited by a /).
 func (p Path) Segments() []string {
@@ -54,78 +223,1025 @@ func (p Path) Segments() []string {
 	return segments
 }
 
+// TrimProtocol returns the segments of p without its protocol: the root key
+// followed by the other segments, e.g. [<cid> a b] for /dms3fs/<cid>/a/b.
+func (p Path) TrimProtocol() []string {
+	return p.Segments()[p.rootLen()-1:]
+}
+
+// Scheme returns the protocol of p, like url.URL.Scheme, e.g. "dms3fs".
+// Invalid paths have no scheme.
+func (p Path) Scheme() string {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return ""
+	}
+	return cp.Segments()[0]
+}
+
+// Host returns the root of p, a cid or a dms3ns name, like url.URL.Host.
+// Invalid paths have no host.
+func (p Path) Host() string {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return ""
+	}
+	return cp.Segments()[1]
+}
+
+// PathPart returns the segments of p following its root, joined and
+// prefixed with a slash like url.URL.Path, or "" when there are none.
+func (p Path) PathPart() string {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return ""
+	}
+	segs := cp.Segments()
+	if len(segs) == 2 {
+		return ""
+	}
+	return "/" + strings.Join(segs[2:], "/")
+}
+
+// EstimatedHops returns the number of segments of p following its root,
+// which is an upper bound on the number of nodes a resolver fetches besides
+// the root, not counting descents into sharded directories. No I/O is done.
+func (p Path) EstimatedHops() int {
+	return len(p.TrimProtocol()) - 1
+}
+
+// ForEachSegment calls fn with the index and value of every segment of p,
+// in order, until fn returns false. Unlike Segments it scans p in place and
+// doesn't allocate. Empty segments are skipped, but p is not cleaned: "."
+// and ".." are passed to fn as they are, which makes no difference for the
+// paths returned by ParsePath.
+func (p Path) ForEachSegment(fn func(i int, seg string) bool) {
+	s := string(p)
+	for i := 0; len(s) > 0; {
+		end := strings.IndexByte(s, '/')
+		if end < 0 {
+			end = len(s)
+		}
+		if end > 0 {
+			if !fn(i, s[:end]) {
+				return
+			}
+			i++
+		}
+		if end == len(s) {
+			return
+		}
+		s = s[end+1:]
+	}
+}
+
+// HasSegment returns whether name is one of the segments of p following its
+// root. Only whole segments match.
+func (p Path) HasSegment(name string) bool {
+	for _, s := range p.TrimProtocol()[1:] {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
 // String converts a path to string.
 func (p Path) String() string {
 	return string(p)
 }
 
+// Clone returns a copy of p which shares no memory with it. As long as Path
+// is a string this is only useful to release a large buffer p is sliced
+// from, but it keeps working if Path ever caches state internally.
+func (p Path) Clone() Path {
+	return Path(string([]byte(p)))
+}
+
+// CacheKey returns a string identifying the content p refers to, suitable as
+// a key for caches. Equivalent paths, e.g. ones differing only by slashes or
+// by the multibase their root cid is encoded in, get the same key. CIDv0 and
+// CIDv1 roots are kept apart. Invalid paths get a key of their own.
+func (p Path) CacheKey() string {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return path.Clean(string(p))
+	}
+
+	segs := cp.Segments()
+	if segs[0] != "dms3ns" {
+		if c, err := cid.Decode(segs[1]); err == nil {
+			segs[1] = c.String()
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// Hash returns a hash of the canonical form of p (see CacheKey), which is
+// stable across processes. It is meant for bucketing paths, e.g. to shard
+// them, and is not suitable for any security purpose.
+func (p Path) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(p.CacheKey()))
+	return h.Sum64()
+}
+
+// SameRoot returns true if p and other are rooted at the same content. The
+// protocols must match first, dms3fs and dms3ld counting as one since both
+// address immutable objects: a dms3ns name and an object with the same bytes
+// are different roots. Cid roots are then compared by multihash, so that a
+// CIDv0 and a CIDv1 of the same content match; other roots, like dms3ns
+// names, must be identical.
+func (p Path) SameRoot(other Path) bool {
+	proto, root := p.root()
+	oproto, oroot := other.root()
+	if rootClass(proto) != rootClass(oproto) {
+		return false
+	}
+
+	c, err := cid.Decode(root)
+	oc, oerr := cid.Decode(oroot)
+	if err == nil && oerr == nil {
+		return bytes.Equal(c.Hash(), oc.Hash())
+	}
+	return root == oroot
+}
+
+// rootClass returns the protocol under which roots of proto are compared by
+// SameRoot.
+func rootClass(proto string) string {
+	if proto == "dms3ld" {
+		return "dms3fs"
+	}
+	return proto
+}
+
+// RootSet returns the distinct root cids of paths, in the order they first
+// appear. Like with SameRoot, roots are compared by multihash, so a CIDv0
+// and a CIDv1 of the same content count once, as the one seen first. It
+// fails on the first path which isn't rooted at a cid.
+func RootSet(paths []Path) ([]*cid.Cid, error) {
+	var roots []*cid.Cid
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		c, _, err := SplitAbsPath(p)
+		if err != nil {
+			return nil, err
+		}
+		if k := string(c.Hash()); !seen[k] {
+			seen[k] = true
+			roots = append(roots, c)
+		}
+	}
+	return roots, nil
+}
+
+// SegmentDistance returns the edit distance between the segments of a and b
+// after their roots: the number of segments to insert, delete or replace to
+// turn one into the other. Paths with different roots are infinitely far
+// apart, which is reported as math.MaxInt32. This can be used to rank
+// candidates when suggesting corrections for a path.
+func SegmentDistance(a, b Path) int {
+	if !a.SameRoot(b) {
+		return math.MaxInt32
+	}
+
+	as := a.Segments()[a.rootLen():]
+	bs := b.Segments()[b.rootLen():]
+
+	// Levenshtein distance, keeping a single row of the matrix
+	row := make([]int, len(bs)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(as); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(bs); j++ {
+			cur := row[j]
+			cost := 1
+			if as[i-1] == bs[j-1] {
+				cost = 0
+			}
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = cur
+		}
+	}
+	return row[len(bs)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// CollidesWith reports whether p and other would be exported to the same
+// file: they have the same root, as with SameRoot, and the same segments
+// after it. With caseInsensitive, segments which only differ in case are
+// the same, like File.txt and file.txt on a case-insensitive file system;
+// this applies to the parent directories too.
+func (p Path) CollidesWith(other Path, caseInsensitive bool) bool {
+	if !p.SameRoot(other) {
+		return false
+	}
+
+	a := p.Segments()[p.rootLen():]
+	b := other.Segments()[other.rootLen():]
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(caseInsensitive && strings.EqualFold(a[i], b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToLowerSegments returns p with every segment after its root lowercased,
+// for case-insensitive matching. The protocol and the root are kept as they
+// are, since most cid encodings are case-sensitive.
+func (p Path) ToLowerSegments() Path {
+	segs := p.Segments()
+	n := p.rootLen()
+	for i := n; i < len(segs); i++ {
+		segs[i] = strings.ToLower(segs[i])
+	}
+	if n == 1 {
+		return Path(Join(segs))
+	}
+	return Path("/" + Join(segs))
+}
+
+// rootLen returns the number of leading segments of p making its root: the
+// protocol and key, or just the key for paths without a protocol.
+func (p Path) rootLen() int {
+	segs := p.Segments()
+	if len(segs) >= 2 {
+		if _, ok := lookupProtocol(segs[0]); ok {
+			return 2
+		}
+	}
+	return 1
+}
+
+// root returns the protocol of p and the first segment after it. Paths
+// which aren't prefixed by a protocol are taken to be dms3fs paths.
+func (p Path) root() (proto string, root string) {
+	segs := p.Segments()
+	if len(segs) >= 2 {
+		if _, ok := lookupProtocol(segs[0]); ok {
+			return segs[0], segs[1]
+		}
+	}
+	return "dms3fs", segs[0]
+}
+
 // IsJustAKey returns true if the path is of the form <key> or /dms3fs/<key>, or
 // /dms3ld/<key>
 func (p Path) IsJustAKey() bool {
-	parts := p.Segments()
-	return len(parts) == 2 && (parts[0] == "dms3fs" || parts[0] == "dms3ld")
+	return isJustAKey(path.Clean(string(p)))
+}
+
+// isJustAKey implements IsJustAKey over an already cleaned path without
+// splitting it into segments.
+func isJustAKey(cleaned string) bool {
+	trimmed := strings.TrimPrefix(cleaned, "/")
+	i := strings.IndexByte(trimmed, '/')
+	if i < 0 || strings.LastIndexByte(trimmed, '/') != i {
+		return false
+	}
+	return trimmed[:i] == "dms3fs" || trimmed[:i] == "dms3ld"
 }
 
 // PopLastSegment returns a new Path without its final segment, and the final
 // segment, separately. If there is no more to pop (the path is just a key),
 // the original path is returned.
+//
+// The returned path shares its backing string with p so that walking up
+// from a deep path to its root only costs a constant amount of allocations
+// per call.
 func (p Path) PopLastSegment() (Path, string, error) {
-
-	if p.IsJustAKey() {
+	cleaned := path.Clean(string(p))
+	if isJustAKey(cleaned) {
 		return p, "", nil
 	}
 
-	segs := p.Segments()
-	newPath, err := ParsePath("/" + strings.Join(segs[:len(segs)-1], "/"))
+	i := strings.LastIndexByte(cleaned, '/')
+	head := "/"
+	switch {
+	case i > 0 && cleaned[0] == '/':
+		head = cleaned[:i]
+	case i > 0:
+		head = "/" + cleaned[:i]
+	}
+
+	newPath, err := ParsePath(head)
 	if err != nil {
 		return "", "", err
 	}
 
-	return newPath, segs[len(segs)-1], nil
+	return newPath, cleaned[i+1:], nil
+}
+
+// Split splits p after its last segment, like filepath.Split, returning the
+// parent path and the last segment. Paths which are just a root come back
+// whole with an empty file. Paths PopLastSegment fails on come back
+// unchanged with an empty file too.
+func Split(p Path) (dir Path, file string) {
+	dir, file, err := p.PopLastSegment()
+	if err != nil {
+		return p, ""
+	}
+	return dir, file
+}
+
+// RootString returns the root cid of p in its canonical text form. Paths
+// which aren't rooted at a cid, like dms3ns paths, fail with
+// ErrNotCidRooted.
+func (p Path) RootString() (string, error) {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return "", err
+	}
+
+	segs := cp.Segments()
+	if segs[0] == "dms3ns" {
+		return "", ErrNotCidRooted{Protocol: segs[0]}
+	}
+	c, err := cid.Decode(segs[1])
+	if err != nil {
+		return "", ErrNotCidRooted{Protocol: segs[0]}
+	}
+	return c.String(), nil
+}
+
+// DNSLinkRecord returns the value of the DNSLink TXT record pointing to p,
+// e.g. "dnslink=/dms3fs/<cid>/a". p must be rooted at a cid; dms3ns paths
+// fail with ErrNotCidRooted.
+func (p Path) DNSLinkRecord() (string, error) {
+	cp, _, _, err := ParsePathCid(string(p))
+	if err != nil {
+		return "", err
+	}
+	return "dnslink=" + string(cp), nil
+}
+
+// CheckResolvable checks, without any DAG at hand, that p has the shape of a
+// path a resolver can walk: a valid /dms3fs/ or /dms3ld/ path rooted at a
+// cid, whose segments all pass ValidateSegment. dms3ns paths, which need a
+// name system first, fail with ErrNotCidRooted.
+func (p Path) CheckResolvable() error {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return err
+	}
+
+	segs := cp.Segments()
+	if segs[0] != "dms3fs" && segs[0] != "dms3ld" {
+		return ErrNotCidRooted{Protocol: segs[0]}
+	}
+	if _, err := cid.Decode(segs[1]); err != nil {
+		return ErrInvalidSegment{Index: 0, Segment: segs[1], Err: err}
+	}
+	for i, s := range segs[2:] {
+		if err := ValidateSegment(s); err != nil {
+			return ErrInvalidSegment{Index: i + 1, Segment: s, Err: err}
+		}
+	}
+	return nil
+}
+
+// TrimPrefix returns a path rooted at the same key as p, containing only the
+// segments of p which come after the segments of prefix. It returns
+// ErrNotPrefix if prefix is not a prefix of p segment-wise.
+func (p Path) TrimPrefix(prefix Path) (Path, error) {
+	segs := p.Segments()
+	psegs := prefix.Segments()
+	if len(psegs) < 2 || len(psegs) > len(segs) {
+		return "", ErrNotPrefix
+	}
+	for i := range psegs {
+		if segs[i] != psegs[i] {
+			return "", ErrNotPrefix
+		}
+	}
+
+	return ParsePath("/" + Join(append(segs[:2:2], segs[len(psegs):]...)))
+}
+
+// DefaultIndexFile is the name of the file served for directories by
+// gateways.
+const DefaultIndexFile = "index.html"
+
+// IndexFile returns the path to the index file with the given name in the
+// directory p, DefaultIndexFile when name is empty. name must pass
+// ValidateSegment.
+func (p Path) IndexFile(name string) (Path, error) {
+	if name == "" {
+		name = DefaultIndexFile
+	}
+	if err := ValidateSegment(name); err != nil {
+		return "", err
+	}
+	return ParsePath(string(p) + "/" + name)
+}
+
+// AppendExtension returns p with ext appended to its final segment, e.g. to
+// go from /dms3fs/<cid>/file to /dms3fs/<cid>/file.json. The leading dot of
+// ext is optional. It returns ErrNoSegments for paths made of just a root.
+func (p Path) AppendExtension(ext string) (Path, error) {
+	segs := p.Segments()
+	if len(segs) <= 2 {
+		return "", ErrNoSegments
+	}
+
+	ext = strings.TrimPrefix(ext, ".")
+	if ext == "" {
+		return "", errors.New("empty extension")
+	}
+
+	last := segs[len(segs)-1] + "." + ext
+	if err := ValidateSegment(last); err != nil {
+		return "", err
+	}
+	segs[len(segs)-1] = last
+
+	return ParsePath("/" + Join(segs))
+}
+
+// WithTrailingSlash returns p with a single trailing slash when on is true,
+// and without any otherwise, for systems which tell /dir from /dir/ apart.
+// Only the string form changes: the segments of p stay the same.
+func (p Path) WithTrailingSlash(on bool) Path {
+	trimmed := strings.TrimRight(string(p), "/")
+	if trimmed == "" {
+		return p
+	}
+	if on {
+		return Path(trimmed + "/")
+	}
+	return Path(trimmed)
+}
+
+// ToFSPath returns the part of p after its root as a slash separated,
+// absolute, file system path, e.g. "/a/b/c" for /dms3fs/<cid>/a/b/c, or "/"
+// for a root. It fails if any segment is not safe to use as a file name:
+// ".", ".." and segments containing a null byte or a backslash are refused.
+// The segments are checked as written in p, before any cleaning.
+func (p Path) ToFSPath() (string, error) {
+	var segs []string
+	for _, seg := range strings.Split(string(p), "/") {
+		if seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+
+	if len(segs) > 0 {
+		if _, ok := lookupProtocol(segs[0]); ok {
+			segs = segs[1:]
+		}
+	}
+	if len(segs) == 0 {
+		return "", ErrNoComponents
+	}
+
+	for _, seg := range segs[1:] {
+		if seg == "." || seg == ".." || strings.ContainsAny(seg, "\x00\\") {
+			return "", fmt.Errorf("segment %q is not a safe file name", seg)
+		}
+	}
+	return "/" + Join(segs[1:]), nil
 }
 
 // FromSegments returns a path given its different segments.
+// Every segment must pass ValidateSegment. When prefix is just a protocol
+// whose paths are rooted at a cid (e.g. "/dms3fs/"), or empty, the first
+// segment must be a valid cid. A prefix of just "/" leaves the protocol to
+// the first segment. Invalid segments are reported with an
+// ErrInvalidSegment.
 func FromSegments(prefix string, seg ...string) (Path, error) {
+	for i, s := range seg {
+		if err := ValidateSegment(s); err != nil {
+			return "", ErrInvalidSegment{Index: i, Segment: s, Err: err}
+		}
+	}
+
+	proto := strings.Trim(prefix, "/")
+	rootIsCid, ok := lookupProtocol(proto)
+	if len(seg) > 0 && (prefix == "" || proto != "" && ok && rootIsCid) {
+		if _, err := cid.Decode(seg[0]); err != nil {
+			return "", ErrInvalidSegment{Index: 0, Segment: seg[0], Err: err}
+		}
+	}
+
 	return ParsePath(prefix + strings.Join(seg, "/"))
 }
 
+// ValidateSegment checks that s can be used as a single segment of a path:
+// it must not be empty, must not contain a slash and must not be longer than
+// MaxSegmentLength.
+func ValidateSegment(s string) error {
+	if s == "" {
+		return errors.New("segment is empty")
+	}
+	if strings.ContainsRune(s, '/') {
+		return errors.New("segment contains a slash")
+	}
+	if MaxSegmentLength > 0 && len(s) > MaxSegmentLength {
+		return ErrSegmentTooLong{Len: len(s)}
+	}
+	return nil
+}
+
+// checkSegmentLengths checks the length of every segment of the cleaned path
+// txt against MaxSegmentLength, without splitting it.
+func checkSegmentLengths(txt string) error {
+	if MaxSegmentLength <= 0 {
+		return nil
+	}
+
+	// bare cids get prefixed with /dms3fs/, count that segment too.
+	index, start := 1, 0
+	if strings.HasPrefix(txt, "/") {
+		index, start = 0, 1
+	}
+	for i := start; i <= len(txt); i++ {
+		if i < len(txt) && txt[i] != '/' {
+			continue
+		}
+		if l := i - start; l > MaxSegmentLength {
+			return ErrSegmentTooLong{Index: index, Len: l}
+		}
+		index++
+		start = i + 1
+	}
+	return nil
+}
+
 // ParsePath returns a well-formed dms3fs Path.
 // The returned path will always be prefixed with /dms3fs/ or /dms3ns/.
 // The prefix will be added if not present in the given string.
+// The returned path is canonical: it is cleaned like path.Clean does, so
+// equivalent inputs always parse to identical Paths and parsing the string
+// form of a parsed Path returns it unchanged. A ".." reaching the root of
+// the path is an error rather than being cleaned away.
 // This function will return an error when the given string is
 // not a valid dms3fs path.
 func ParsePath(txt string) (Path, error) {
-	parts := strings.Split(txt, "/")
+	p, _, err := parsePath(txt)
+	return p, err
+}
+
+// parsePath implements ParsePath, also returning the root cid of the path
+// when it had to be decoded, nil otherwise.
+func parsePath(txt string) (Path, *cid.Cid, error) {
+	if err := checkCharacters(txt); err != nil {
+		return "", nil, err
+	}
+	raw := txt
+	txt, err := cleanPath(txt)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkSegmentLengths(txt); err != nil {
+		return "", nil, err
+	}
+
+	// only the first three parts are inspected, don't split any further.
+	parts := strings.SplitN(txt, "/", 4)
 	if len(parts) == 1 {
-		kp, err := ParseCidToPath(txt)
+		c, err := decodeRoot(txt)
 		if err == nil {
-			return kp, nil
+			return FromCid(c), c, nil
 		}
 	}
 
 	// if the path doesnt begin with a '/'
 	// we expect this to start with a hash, and be an 'dms3fs' path
 	if parts[0] != "" {
-		if _, err := ParseCidToPath(parts[0]); err != nil {
-			return "", ErrBadPath
+		c, err := decodeRoot(parts[0])
+		if err != nil {
+			return "", nil, ErrBadPath
 		}
 		// The case when the path starts with hash without a protocol prefix
-		return Path("/dms3fs/" + txt), nil
+		return Path("/dms3fs/" + txt), c, nil
 	}
 
 	if len(parts) < 3 {
-		return "", ErrBadPath
+		// "/dms3fs/" names a protocol without a root
+		if rawParts := strings.SplitN(raw, "/", 4); len(parts) == 2 && len(rawParts) > 2 && rawParts[1] == parts[1] {
+			if _, ok := lookupProtocol(parts[1]); ok {
+				return "", nil, ErrNoComponents
+			}
+		}
+		return "", nil, ErrBadPath
+	}
+
+	rootIsCid, ok := lookupProtocol(parts[1])
+	if !ok {
+		return "", nil, ErrBadPath
+	}
+	var c *cid.Cid
+	if rootIsCid {
+		var err error
+		if c, err = decodeRoot(parts[2]); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return Path(txt), c, nil
+}
+
+// cleanPath cleans txt like path.Clean does, except that a ".." which would
+// climb to the root of the path or above it is rejected with ErrBadPath:
+// cleaning it away would silently change the root, or the protocol, the path
+// points to.
+func cleanPath(txt string) (string, error) {
+	// the protocol and the root, or just the root when there is no prefix
+	rootDepth := 2
+	if !strings.HasPrefix(txt, "/") {
+		rootDepth = 1
+	}
+
+	depth := 0
+	for _, seg := range strings.Split(txt, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if depth <= rootDepth {
+				return "", ErrBadPath
+			}
+			depth--
+		default:
+			depth++
+		}
+	}
+	return path.Clean(txt), nil
+}
+
+// decodeRoot decodes the root cid of a path, like ParseCidToPath does.
+func decodeRoot(txt string) (*cid.Cid, error) {
+	if txt == "" {
+		return nil, ErrNoComponents
 	}
+	return cid.Decode(txt)
+}
 
-	if parts[1] == "dms3fs" {
-		if _, err := ParseCidToPath(parts[2]); err != nil {
+// ParsePathCid is like ParsePath followed by SplitAbsPath, decoding the root
+// cid only once: it returns the parsed path, its root cid and the segments
+// following it. Paths which aren't rooted at a cid, like dms3ns paths, fail
+// with ErrNotCidRooted.
+func ParsePathCid(txt string) (Path, *cid.Cid, []string, error) {
+	p, c, err := parsePath(txt)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	segs := p.Segments()
+	if c == nil {
+		if segs[0] != "dms3ld" {
+			return "", nil, nil, ErrNotCidRooted{Protocol: segs[0]}
+		}
+		if c, err = cid.Decode(segs[1]); err != nil {
+			return "", nil, nil, ErrNotCidRooted{Protocol: segs[0]}
+		}
+	}
+	return p, c, segs[2:], nil
+}
+
+// RegisterProtocol makes ParsePath accept paths prefixed with /<name>/ on top
+// of the default /dms3fs/, /dms3ns/ and /dms3ld/ ones. When rootIsCid is
+// true, the first component after the prefix must be a valid cid.
+// Registering a protocol twice is an error.
+func RegisterProtocol(name string, rootIsCid bool) error {
+	if name == "" || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("invalid protocol name %q", name)
+	}
+
+	protocolsLk.Lock()
+	defer protocolsLk.Unlock()
+
+	if _, ok := protocols[name]; ok {
+		return fmt.Errorf("protocol %q is already registered", name)
+	}
+	protocols[name] = rootIsCid
+	return nil
+}
+
+// KnownProtocols returns the protocols ParsePath accepts, the default ones
+// along with the registered ones, sorted.
+func KnownProtocols() []string {
+	protocolsLk.RLock()
+	defer protocolsLk.RUnlock()
+
+	out := make([]string, 0, len(protocols))
+	for name := range protocols {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// lookupProtocol returns whether name is a known protocol and whether its
+// paths must be rooted at a cid.
+func lookupProtocol(name string) (rootIsCid bool, ok bool) {
+	protocolsLk.RLock()
+	defer protocolsLk.RUnlock()
+
+	rootIsCid, ok = protocols[name]
+	return rootIsCid, ok
+}
+
+// Protocol returns the protocol ("dms3fs", "dms3ns", "dms3ld" or one added
+// with RegisterProtocol) the given string would be parsed as, or "" if it
+// doesn't look like a path at all.
+// Unlike ParsePath, it only inspects the shape of the string and does not
+// decode the root cid, so it is cheap enough for routing decisions. A
+// successful result does not mean that ParsePath will accept the string.
+func Protocol(s string) string {
+	if strings.HasPrefix(s, "/") {
+		i := strings.IndexByte(s[1:], '/') + 1
+		if i <= 1 || i == len(s)-1 {
+			return ""
+		}
+		if _, ok := lookupProtocol(s[1:i]); ok {
+			return s[1:i]
+		}
+		return ""
+	}
+
+	root := s
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		root = s[:i]
+	}
+	if looksLikeCid(root) {
+		return "dms3fs"
+	}
+	return ""
+}
+
+// looksLikeCid reports whether s has the shape of a cid: a long run of
+// alphanumeric characters (a CIDv0 is 46 characters long, CIDv1s are longer).
+func looksLikeCid(s string) bool {
+	if len(s) < 46 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseOptions changes the way ParsePathWithOptions parses paths. The zero
+// value parses paths exactly like ParsePath.
+type ParseOptions struct {
+	// Backslashes makes backslashes separate segments like slashes do, for
+	// paths pasted from Windows. By default they are kept within segments.
+	Backslashes bool
+
+	// NormalizeSegment, when set, is applied to every segment following
+	// the root, e.g. norm.NFC.String from golang.org/x/text/unicode/norm
+	// so that equivalent unicode forms of a name resolve the same. The
+	// protocol and the root are never normalized.
+	NormalizeSegment func(string) string
+
+	// RequireCanonicalCid makes paths whose root cid isn't written the way
+	// the cid itself would be encoded, e.g. a CIDv1 in another multibase,
+	// fail with ErrNonCanonicalCid, so that stored paths are uniform.
+	RequireCanonicalCid bool
+}
+
+// ParsePathWithOptions is like ParsePath, with the given options.
+func ParsePathWithOptions(txt string, opts ParseOptions) (Path, error) {
+	if opts.Backslashes {
+		txt = strings.Replace(txt, "\\", "/", -1)
+	}
+	p, err := ParsePath(txt)
+	if err != nil {
+		return "", err
+	}
+	if opts.RequireCanonicalCid {
+		if err := checkCanonicalRoot(txt); err != nil {
 			return "", err
 		}
-	} else if parts[1] != "dms3ns" && parts[1] != "dms3ld" { //TODO: make this smarter
-		return "", ErrBadPath
 	}
+	if opts.NormalizeSegment == nil {
+		return p, nil
+	}
+
+	segs := p.Segments()
+	for i := 2; i < len(segs); i++ {
+		segs[i] = opts.NormalizeSegment(segs[i])
+	}
+	return ParsePath("/" + strings.Join(segs, "/"))
+}
+
+// checkCanonicalRoot returns ErrNonCanonicalCid if txt, a valid path, is
+// rooted at a cid which isn't written in its canonical form. txt is checked
+// rather than the parsed path, as bare cids are re-encoded when parsed.
+func checkCanonicalRoot(txt string) error {
+	root := strings.TrimPrefix(path.Clean(txt), "/")
+	if strings.HasPrefix(txt, "/") {
+		parts := strings.SplitN(root, "/", 3)
+		if rootIsCid, _ := lookupProtocol(parts[0]); !rootIsCid {
+			return nil
+		}
+		root = parts[1]
+	}
+	if i := strings.IndexByte(root, '/'); i >= 0 {
+		root = root[:i]
+	}
+
+	c, err := cid.Decode(root)
+	if err != nil {
+		return err
+	}
+	if c.String() != root {
+		return ErrNonCanonicalCid
+	}
+	return nil
+}
+
+// ParsePathDetailed is like ParsePath, and also tells whether the /dms3fs/
+// prefix was added to txt because it started with a bare cid.
+func ParsePathDetailed(txt string) (Path, bool, error) {
+	p, err := ParsePath(txt)
+	if err != nil {
+		return "", false, err
+	}
+	return p, !strings.HasPrefix(txt, "/"), nil
+}
+
+// ParseVersionedPath parses txt like ParsePath after removing a version
+// suffix from it, returning the path and the version, e.g.
+// /dms3fs/<cid>/a/b and "v3" for /dms3fs/<cid>/a/b@v3. Only an @ in the
+// final segment followed by letters, digits, dashes and underscores up to
+// the very end of txt starts a version, so names like user@example.com are
+// kept whole. The version is empty when txt has no suffix.
+func ParseVersionedPath(txt string) (Path, string, error) {
+	var version string
+	if at := strings.LastIndex(txt, "@"); at > 0 && txt[at-1] != '/' && isVersion(txt[at+1:]) {
+		txt, version = txt[:at], txt[at+1:]
+	}
+
+	p, err := ParsePath(txt)
+	if err != nil {
+		return "", "", err
+	}
+	return p, version, nil
+}
+
+// isVersion tells whether s is a valid version token for ParseVersionedPath.
+func isVersion(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePathWithDiagnostics is like ParsePath, and also returns warnings
+// about deprecated forms found in txt which ParsePath accepts anyway, like
+// a bare cid without a protocol prefix or a CIDv0 root. The warnings are
+// meant for humans and their wording may change.
+func ParsePathWithDiagnostics(txt string) (Path, []string, error) {
+	p, prefixed, err := ParsePathDetailed(txt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var warnings []string
+	if prefixed {
+		warnings = append(warnings, "bare cid auto-prefixed with /dms3fs/")
+	} else if string(p) != txt {
+		warnings = append(warnings, "path cleaned to "+string(p))
+	}
+
+	segs := p.Segments()
+	if rootIsCid, _ := lookupProtocol(segs[0]); rootIsCid {
+		if c, err := cid.Decode(segs[1]); err == nil && c.Version() == 0 {
+			warnings = append(warnings, "CIDv0 root; consider CIDv1")
+		}
+	}
+	return p, warnings, nil
+}
+
+// ParseAny parses user input which may be any of the forms paths are
+// commonly given in, trying in order: a bare cid, a path as accepted by
+// ParsePath, an http(s) gateway url whose path is a dms3fs path and a domain
+// name taken as a dms3ns name. When every form fails, the error lists why
+// each of them did.
+func ParseAny(s string) (Path, error) {
+	s = strings.TrimSpace(s)
+
+	p, cerr := ParseCidToPath(s)
+	if cerr == nil {
+		return p, nil
+	}
+	p, perr := ParsePath(s)
+	if perr == nil {
+		return p, nil
+	}
+	p, uerr := parseGatewayURL(s)
+	if uerr == nil {
+		return p, nil
+	}
+	p, nerr := FromName(s)
+	if nerr == nil {
+		return p, nil
+	}
+	return "", fmt.Errorf("%q is not a cid (%s), a path (%s), a gateway url (%s) nor a name (%s)", s, cerr, perr, uerr, nerr)
+}
+
+// StripHost removes a leading host from scheme-less references like
+// "gateway.example/dms3fs/<cid>/a", so that what follows can be parsed.
+// Strings which don't start with a host followed by a known protocol
+// prefix are returned unchanged, and so are strings starting with a cid,
+// which is the root of the path rather than a host.
+func StripHost(s string) string {
+	i := strings.IndexByte(s, '/')
+	if i <= 0 {
+		return s
+	}
+	if looksLikeCid(s[:i]) || Protocol(s[i:]) == "" {
+		return s
+	}
+	return s[i:]
+}
+
+// URLEncode percent-encodes p, slashes included, so that it can be used as
+// a single segment of the path of a url. URLDecode reverses it.
+func (p Path) URLEncode() string {
+	return url.PathEscape(string(p))
+}
+
+// URLDecode parses a path encoded by URLEncode.
+func URLDecode(s string) (Path, error) {
+	txt, err := url.PathUnescape(s)
+	if err != nil {
+		return "", err
+	}
+	return ParsePath(txt)
+}
+
+// parseGatewayURL parses the path of an http(s) url.
+func parseGatewayURL(s string) (Path, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("not an http url")
+	}
+	return ParsePath(u.Path)
+}
 
-	return Path(txt), nil
+// ReadPath reads a single path from r, up to its end, and parses it with
+// ParsePath. Whitespace around the path, like a trailing newline, is
+// ignored; anything else following the path makes it invalid.
+func ReadPath(r io.Reader) (Path, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return ParsePath(strings.TrimSpace(string(b)))
+}
+
+// MustParse is like ParsePath but panics if the given string cannot be
+// parsed. It simplifies safe initialization of global variables holding
+// paths and of test fixtures.
+func MustParse(txt string) Path {
+	p, err := ParsePath(txt)
+	if err != nil {
+		panic(`path: ParsePath(` + strconv.Quote(txt) + `): ` + err.Error())
+	}
+	return p
+}
+
+// checkCharacters returns an ErrIllegalCharacter for the first control
+// character (0x00-0x1F and 0x7F) found in txt.
+func checkCharacters(txt string) error {
+	for i := 0; i < len(txt); i++ {
+		if txt[i] < 0x20 || txt[i] == 0x7F {
+			return ErrIllegalCharacter{Char: txt[i], Pos: i}
+		}
+	}
+	return nil
 }
 
 // ParseCidToPath takes a CID in string form and returns a valid dms3fs Path.
@@ -153,6 +1269,44 @@ func Join(pths []string) string {
 	return strings.Join(pths, "/")
 }
 
+// JoinAll joins base with each of the relative paths rels, returning one
+// parsed path per relative path. Relative paths must be non-empty, must not
+// start with a slash and must not contain "." or ".." segments, so the
+// results stay under base. The first invalid one is reported with an
+// ErrInvalidSegment whose Index is its position in rels.
+func JoinAll(base Path, rels ...string) ([]Path, error) {
+	out := make([]Path, 0, len(rels))
+	for i, rel := range rels {
+		if err := checkRelative(rel); err != nil {
+			return nil, ErrInvalidSegment{Index: i, Segment: rel, Err: err}
+		}
+
+		p, err := ParsePath(string(base) + "/" + rel)
+		if err != nil {
+			return nil, ErrInvalidSegment{Index: i, Segment: rel, Err: err}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// checkRelative checks that rel is a relative path staying under the path
+// it is joined to.
+func checkRelative(rel string) error {
+	if rel == "" {
+		return errors.New("relative path is empty")
+	}
+	if strings.HasPrefix(rel, "/") {
+		return errors.New("relative path is absolute")
+	}
+	for _, s := range strings.Split(rel, "/") {
+		if s == "." || s == ".." {
+			return errors.New("relative path contains " + s)
+		}
+	}
+	return nil
+}
+
 // SplitList splits strings usings /
 func SplitList(pth string) []string {
 	return strings.Split(pth, "/")
@@ -179,3 +1333,150 @@ func SplitAbsPath(fpath Path) (*cid.Cid, []string, error) {
 
 	return c, parts[1:], nil
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler. The protocol, the root
+// and the remaining segments of the path are stored one after the other,
+// each prefixed by its length as a uvarint. Cid roots are stored in their
+// binary form, which is much shorter than their text form.
+func (p Path) MarshalBinary() ([]byte, error) {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return nil, err
+	}
+
+	segs := cp.Segments()
+	root := []byte(segs[1])
+	if rootIsCid, _ := lookupProtocol(segs[0]); rootIsCid {
+		c, err := cid.Decode(segs[1])
+		if err != nil {
+			return nil, err
+		}
+		root = c.Bytes()
+	}
+
+	buf := make([]byte, 0, len(cp))
+	buf = appendBinaryField(buf, []byte(segs[0]))
+	buf = appendBinaryField(buf, root)
+	for _, s := range segs[2:] {
+		buf = appendBinaryField(buf, []byte(s))
+	}
+	return buf, nil
+}
+
+// SortKey returns a key for p which sorts in tree order when compared as
+// bytes, for sorted stores like LevelDB: the protocol, the root and each
+// segment, each prefixed by its length as a big endian uint32, with cid
+// roots in their binary form. The key of a path is a prefix of the keys of
+// every path below it and of no other, so a subtree can be scanned with a
+// prefix range. Siblings sort by length, then bytewise.
+func (p Path) SortKey() []byte {
+	if cp, err := ParsePath(string(p)); err == nil {
+		p = cp
+	}
+
+	segs := p.Segments()
+	key := make([]byte, 0, len(p)+4*len(segs))
+	for i, s := range segs {
+		field := []byte(s)
+		if i == 1 {
+			if rootIsCid, _ := lookupProtocol(segs[0]); rootIsCid {
+				if c, err := cid.Decode(s); err == nil {
+					field = c.Bytes()
+				}
+			}
+		}
+
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(field)))
+		key = append(append(key, l[:]...), field...)
+	}
+	return key
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding the form
+// produced by MarshalBinary. Cid roots come back in their default text
+// encoding.
+func (p *Path) UnmarshalBinary(data []byte) error {
+	var fields []string
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || l > uint64(len(data)-n) {
+			return ErrBadPath
+		}
+		fields = append(fields, string(data[n:n+int(l)]))
+		data = data[n+int(l):]
+	}
+	if len(fields) < 2 {
+		return ErrBadPath
+	}
+
+	rootIsCid, ok := lookupProtocol(fields[0])
+	if !ok {
+		return ErrBadPath
+	}
+	if rootIsCid {
+		c, err := cid.Cast([]byte(fields[1]))
+		if err != nil {
+			return err
+		}
+		fields[1] = c.String()
+	}
+
+	np, err := FromSegments("/"+fields[0]+"/", fields[1:]...)
+	if err != nil {
+		return err
+	}
+	*p = np
+	return nil
+}
+
+// EncodedLen returns the length in bytes of the canonical text form of p,
+// the one ParsePath returns, or of p itself when it is invalid.
+func (p Path) EncodedLen() int {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return len(p)
+	}
+	return len(cp)
+}
+
+// BinaryLen returns the length in bytes of the output of MarshalBinary, or 0
+// when p can't be marshaled.
+func (p Path) BinaryLen() int {
+	cp, err := ParsePath(string(p))
+	if err != nil {
+		return 0
+	}
+
+	segs := cp.Segments()
+	rootLen := len(segs[1])
+	if rootIsCid, _ := lookupProtocol(segs[0]); rootIsCid {
+		c, err := cid.Decode(segs[1])
+		if err != nil {
+			return 0
+		}
+		rootLen = len(c.Bytes())
+	}
+
+	n := binaryFieldLen(len(segs[0])) + binaryFieldLen(rootLen)
+	for _, s := range segs[2:] {
+		n += binaryFieldLen(len(s))
+	}
+	return n
+}
+
+// binaryFieldLen returns the length of a field of l bytes once appended by
+// appendBinaryField.
+func binaryFieldLen(l int) int {
+	n := 1
+	for x := uint64(l); x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n + l
+}
+
+func appendBinaryField(buf []byte, field []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	buf = append(buf, l[:binary.PutUvarint(l[:], uint64(len(field)))]...)
+	return append(buf, field...)
+}
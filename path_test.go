@@ -1,7 +1,17 @@
 package path
 
 import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"unsafe"
+
+	cid "github.com/dms3-fs/go-cid"
 )
 
 func TestPathParsing(t *testing.T) {
@@ -83,3 +93,1490 @@ func TestPopLastSegment(t *testing.T) {
 		}
 	}
 }
+
+func TestProtocol(t *testing.T) {
+	cases := map[string]string{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":     "dms3fs",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b": "dms3fs",
+		"/dms3ns/example.com/a": "dms3ns",
+		"/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a": "dms3ld",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":           "dms3fs",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b":       "dms3fs",
+		"zdj7WWeQ43G6JJvLWQWZpyHuAMq6uYWRjkBXFad11vE2LHhQ7":        "dms3fs",
+		"":                          "",
+		"/dms3fs/":                  "",
+		"/dms3xx/QmdfTbBqBPQ7VNxZE": "",
+		"dms3fs/foo":                "",
+		"hello world":               "",
+		"/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n": "",
+	}
+
+	for s, expected := range cases {
+		if proto := Protocol(s); proto != expected {
+			t.Errorf("expected Protocol(%q) to return %q, not %q", s, expected, proto)
+		}
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	p := MustParse("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a")
+	if p.String() != "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a" {
+		t.Fatalf("MustParse returned unexpected path %s", p)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustParse to panic on an invalid path")
+		}
+	}()
+	MustParse("/dms3fs/")
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	cases := map[string]int{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a\x00b": 56,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a\nb":   56,
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n\x7f":            46,
+		"\x00": 0,
+	}
+
+	for p, pos := range cases {
+		_, err := ParsePath(p)
+		ierr, ok := err.(ErrIllegalCharacter)
+		if !ok {
+			t.Fatalf("expected ErrIllegalCharacter parsing %q, got %v", p, err)
+		}
+		if ierr.Pos != pos || ierr.Char != p[pos] {
+			t.Fatalf("expected illegal character %q at %d in %q, got %q at %d", p[pos], pos, p, ierr.Char, ierr.Pos)
+		}
+	}
+}
+
+// deepPath returns a valid path with the given number of segments after the
+// root.
+func deepPath(depth int) Path {
+	segs := make([]string, depth)
+	for i := range segs {
+		segs[i] = "segment"
+	}
+	p, err := FromSegments("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/", segs...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// walkToRoot pops every segment of p until only the key is left.
+func walkToRoot(p Path) int {
+	n := 0
+	for {
+		head, tail, err := p.PopLastSegment()
+		if err != nil {
+			panic(err)
+		}
+		if tail == "" {
+			return n
+		}
+		p = head
+		n++
+	}
+}
+
+func TestPopLastSegmentAllocs(t *testing.T) {
+	shallow, deep := deepPath(10), deepPath(100)
+
+	if n := walkToRoot(deep); n != 100 {
+		t.Fatalf("expected 100 pops, got %d", n)
+	}
+
+	perPopShallow := testing.AllocsPerRun(10, func() { walkToRoot(shallow) }) / 10
+	perPopDeep := testing.AllocsPerRun(10, func() { walkToRoot(deep) }) / 100
+
+	// every pop costs a constant amount of allocations, independently of
+	// the depth of the path being popped.
+	if perPopDeep > perPopShallow+1 {
+		t.Fatalf("allocations per pop grow with depth: %.1f at depth 10, %.1f at depth 100", perPopShallow, perPopDeep)
+	}
+}
+
+func BenchmarkPopLastSegmentToRoot(b *testing.B) {
+	p := deepPath(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		walkToRoot(p)
+	}
+}
+
+func TestForEachSegment(t *testing.T) {
+	for _, p := range []Path{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a//b/",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3ns/example.com",
+	} {
+		var segs []string
+		p.ForEachSegment(func(i int, seg string) bool {
+			if i != len(segs) {
+				t.Fatalf("%s: expected index %d, got %d", p, len(segs), i)
+			}
+			segs = append(segs, seg)
+			return true
+		})
+		if strings.Join(segs, "|") != strings.Join(p.Segments(), "|") {
+			t.Fatalf("%s: expected %v, got %v", p, p.Segments(), segs)
+		}
+	}
+
+	var n int
+	deepPath(10).ForEachSegment(func(i int, seg string) bool {
+		n++
+		return i < 3
+	})
+	if n != 4 {
+		t.Fatalf("expected iteration to stop after 4 segments, got %d", n)
+	}
+}
+
+func BenchmarkForEachSegment(b *testing.B) {
+	p := deepPath(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var n int
+		p.ForEachSegment(func(i int, seg string) bool {
+			n += len(seg)
+			return true
+		})
+	}
+}
+
+func BenchmarkSegments(b *testing.B) {
+	p := deepPath(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var n int
+		for _, seg := range p.Segments() {
+			n += len(seg)
+		}
+	}
+}
+
+func TestFromCidExpectCodec(t *testing.T) {
+	c, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := FromCidExpectCodec(c, cid.DagProtobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != FromCid(c) {
+		t.Fatalf("expected %s, got %s", FromCid(c), p)
+	}
+
+	raw := cid.NewCidV1(cid.Raw, c.Hash())
+	_, err = FromCidExpectCodec(raw, cid.DagProtobuf)
+	if err != (ErrUnexpectedCodec{Expected: cid.DagProtobuf, Actual: cid.Raw}) {
+		t.Fatalf("expected ErrUnexpectedCodec, got %v", err)
+	}
+}
+
+func TestFromName(t *testing.T) {
+	cases := map[string]string{
+		"example.com":  "/dms3ns/example.com",
+		"docs.dms3.io": "/dms3ns/docs.dms3.io",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n": "/dms3ns/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+	}
+
+	for name, expected := range cases {
+		p, err := FromName(name)
+		if err != nil {
+			t.Fatalf("FromName failed for %q, but should have succeeded: %s", name, err)
+		}
+		if p.String() != expected {
+			t.Fatalf("expected FromName(%q) to return %s, not %s", name, expected, p)
+		}
+		if _, err := ParsePath(p.String()); err != nil {
+			t.Fatalf("FromName(%q) returned an unparsable path: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "example.com/a", "/example.com", "-example.com", "exa mple.com"} {
+		if _, err := FromName(name); err != ErrBadName {
+			t.Fatalf("expected FromName(%q) to fail with ErrBadName, got %v", name, err)
+		}
+	}
+}
+
+func TestParsePathCanonical(t *testing.T) {
+	cases := map[string]string{
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/":               "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a/":            "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/":       "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/":     "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a//b":  "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b",
+		"//dms3fs//QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a":    "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/./a":    "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/../b": "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/b",
+		"/dms3ns/example.com/a/":                                        "/dms3ns/example.com/a",
+		"/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a//":    "/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+	}
+
+	for s, expected := range cases {
+		p, err := ParsePath(s)
+		if err != nil {
+			t.Fatalf("ParsePath failed to parse %q, but should have succeeded: %s", s, err)
+		}
+		if p.String() != expected {
+			t.Fatalf("expected ParsePath(%q) to return %s, not %s", s, expected, p)
+		}
+
+		again, err := ParsePath(p.String())
+		if err != nil {
+			t.Fatalf("ParsePath failed to reparse %q: %s", p, err)
+		}
+		if again != p {
+			t.Fatalf("ParsePath is not idempotent: %q parsed to %s, then to %s", s, p, again)
+		}
+	}
+
+	// paths escaping their root through ".." are rejected
+	for _, s := range []string{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/..",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/../../a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/../QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/../../dms3ns/evil.com",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/../../QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/../QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX",
+		"/../dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+	} {
+		if _, err := ParsePath(s); err != ErrBadPath {
+			t.Fatalf("expected ParsePath(%q) to fail with ErrBadPath, got %v", s, err)
+		}
+	}
+
+	// a protocol without a root fails like it did before cleaning
+	if _, err := ParsePath("/dms3fs/"); err != ErrNoComponents {
+		t.Fatalf("expected ErrNoComponents, got %v", err)
+	}
+
+	// all the constructors return the same canonical form
+	c := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	fromSegs, err := FromSegments("/dms3fs/", c, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := MustParse(c + "/a/b/")
+	if fromSegs != parsed {
+		t.Fatalf("expected FromSegments and ParsePath to agree: %s != %s", fromSegs, parsed)
+	}
+	if key := MustParse(c + "/"); key != FromString("/dms3fs/"+c) {
+		t.Fatalf("expected ParsePath of a key to return the same path as FromCid, got %s", key)
+	}
+}
+
+// unregisterProtocol undoes RegisterProtocol, so that tests registering
+// protocols can run more than once.
+func unregisterProtocol(name string) {
+	protocolsLk.Lock()
+	defer protocolsLk.Unlock()
+	delete(protocols, name)
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	if _, err := ParsePath("/dms3db/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"); err == nil {
+		t.Fatal("expected an unregistered protocol to be rejected")
+	}
+
+	if err := RegisterProtocol("dms3db", true); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterProtocol("dms3db")
+	if err := RegisterProtocol("dms3db", false); err == nil {
+		t.Fatal("expected registering a protocol twice to fail")
+	}
+	if err := RegisterProtocol("dms3fs", false); err == nil {
+		t.Fatal("expected registering a default protocol to fail")
+	}
+	if err := RegisterProtocol("a/b", false); err == nil {
+		t.Fatal("expected registering a protocol containing a slash to fail")
+	}
+
+	p, err := ParsePath("/dms3db/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "/dms3db/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a" {
+		t.Fatalf("unexpected path %s", p)
+	}
+	if proto := Protocol(p.String()); proto != "dms3db" {
+		t.Fatalf("expected Protocol to recognize the registered protocol, got %q", proto)
+	}
+
+	if _, err := ParsePath("/dms3db/notacid/a"); err == nil {
+		t.Fatal("expected the root of a cid rooted protocol to be validated")
+	}
+
+	if err := RegisterProtocol("dms3names", false); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterProtocol("dms3names")
+	if _, err := ParsePath("/dms3names/example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	v0, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+	v1base16 := "f" + hex.EncodeToString(v1.Bytes())
+
+	equivalent := [][]Path{
+		{
+			"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+			"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/",
+			"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a",
+			"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/b/../a",
+		},
+		{
+			FromString("/dms3fs/" + v1.String() + "/a"),
+			FromString("/dms3fs/" + v1base16 + "/a"),
+		},
+		{
+			"/dms3ns/example.com/a",
+			"/dms3ns/example.com//a/",
+		},
+	}
+
+	keys := make(map[string]int)
+	for i, group := range equivalent {
+		for _, p := range group {
+			key := p.CacheKey()
+			if j, ok := keys[key]; ok && j != i {
+				t.Fatalf("%s has the same cache key as a different path: %s", p, key)
+			}
+			keys[key] = i
+			if key != group[0].CacheKey() {
+				t.Fatalf("expected %s and %s to have the same cache key, got %s and %s", p, group[0], key, group[0].CacheKey())
+			}
+		}
+	}
+
+	if len(keys) != len(equivalent) {
+		t.Fatalf("expected %d distinct keys, got %d", len(equivalent), len(keys))
+	}
+}
+
+func TestTrimPrefix(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c")
+
+	cases := map[Path]string{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":       "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a":     "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/b/c",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/":  "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/c",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c": "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n",
+	}
+
+	for prefix, expected := range cases {
+		trimmed, err := p.TrimPrefix(prefix)
+		if err != nil {
+			t.Fatalf("TrimPrefix(%s) failed, but should have succeeded: %s", prefix, err)
+		}
+		if trimmed.String() != expected {
+			t.Fatalf("expected TrimPrefix(%s) to return %s, not %s", prefix, expected, trimmed)
+		}
+	}
+
+	for _, prefix := range []Path{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/b",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/ab",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c/d",
+		"/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3fs",
+	} {
+		if _, err := p.TrimPrefix(prefix); err != ErrNotPrefix {
+			t.Fatalf("expected TrimPrefix(%s) to fail with ErrNotPrefix, got %v", prefix, err)
+		}
+	}
+}
+
+func TestFromSegmentsValidation(t *testing.T) {
+	c := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+
+	cases := []struct {
+		prefix string
+		segs   []string
+		index  int
+	}{
+		{"/dms3fs/", []string{"", "a"}, 0},
+		{"/dms3fs/", []string{"notacid", "a"}, 0},
+		{"", []string{"notacid"}, 0},
+		{"/dms3fs/", []string{c, "a/b"}, 1},
+		{"/dms3fs/", []string{c, "a", ""}, 2},
+		{"/dms3ns/", []string{"example.com", "a/b"}, 1},
+	}
+
+	for _, tc := range cases {
+		_, err := FromSegments(tc.prefix, tc.segs...)
+		serr, ok := err.(ErrInvalidSegment)
+		if !ok {
+			t.Fatalf("expected ErrInvalidSegment for FromSegments(%q, %q), got %v", tc.prefix, tc.segs, err)
+		}
+		if serr.Index != tc.index || serr.Segment != tc.segs[tc.index] {
+			t.Fatalf("expected segment %d (%q) to be reported for FromSegments(%q, %q), got %d (%q)",
+				tc.index, tc.segs[tc.index], tc.prefix, tc.segs, serr.Index, serr.Segment)
+		}
+	}
+
+	if _, err := FromSegments("/dms3ns/", "example.com", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromSegments("", c, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the protocol can be given as the first segment
+	p, err := FromSegments("/", "dms3fs", c, "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "/dms3fs/"+c+"/f" {
+		t.Fatalf("expected /dms3fs/%s/f, got %s", c, p)
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a")
+	b := FromString("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a/")
+	c := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/b")
+
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected equivalent paths to hash equally: %x != %x", a.Hash(), b.Hash())
+	}
+	if a.Hash() == c.Hash() {
+		t.Fatalf("expected different paths to hash differently")
+	}
+
+	// the hash must never change across runs or releases
+	if a.Hash() != 0xf7d5229a72c6d0d9 {
+		t.Fatalf("hash of %s changed: %#x", a, a.Hash())
+	}
+}
+
+func TestAppendExtension(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/file")
+	expected := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/file.json"
+
+	for _, ext := range []string{"json", ".json"} {
+		withExt, err := p.AppendExtension(ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withExt.String() != expected {
+			t.Fatalf("expected AppendExtension(%q) to return %s, not %s", ext, expected, withExt)
+		}
+	}
+
+	for _, ext := range []string{"", ".", "js/on"} {
+		if _, err := p.AppendExtension(ext); err == nil {
+			t.Fatalf("expected AppendExtension(%q) to fail", ext)
+		}
+	}
+
+	key := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if _, err := key.AppendExtension("json"); err != ErrNoSegments {
+		t.Fatalf("expected AppendExtension on a key to fail with ErrNoSegments, got %v", err)
+	}
+}
+
+func TestWithTrailingSlash(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dir")
+	with := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dir/"
+
+	on := p.WithTrailingSlash(true)
+	if on.String() != with {
+		t.Fatalf("expected %s, got %s", with, on)
+	}
+	if again := on.WithTrailingSlash(true); again != on {
+		t.Fatalf("expected adding a slash twice to return %s, got %s", on, again)
+	}
+	if off := on.WithTrailingSlash(false); off != p {
+		t.Fatalf("expected %s, got %s", p, off)
+	}
+	if off := Path(with + "//").WithTrailingSlash(false); off != p {
+		t.Fatalf("expected every trailing slash to be removed, got %s", off)
+	}
+
+	if strings.Join(on.Segments(), "/") != strings.Join(p.Segments(), "/") {
+		t.Fatalf("expected the segments to be unaffected, got %v and %v", on.Segments(), p.Segments())
+	}
+}
+
+func TestToFSPath(t *testing.T) {
+	cases := map[Path]string{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":         "/",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c":   "/a/b/c",
+		"/dms3ns/example.com/a/b.txt":                                    "/a/b.txt",
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a/":             "/a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/..a/b..": "/..a/b..",
+	}
+
+	for p, expected := range cases {
+		fsPath, err := p.ToFSPath()
+		if err != nil {
+			t.Fatalf("ToFSPath(%s) failed, but should have succeeded: %s", p, err)
+		}
+		if fsPath != expected {
+			t.Fatalf("expected ToFSPath(%s) to return %q, not %q", p, expected, fsPath)
+		}
+	}
+
+	for _, p := range []Path{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/../../etc",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/./a",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a\x00b",
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a\\b",
+		"/dms3fs/",
+	} {
+		if _, err := p.ToFSPath(); err == nil {
+			t.Fatalf("expected ToFSPath(%q) to fail", p)
+		}
+	}
+}
+
+func TestParsePathBackslashes(t *testing.T) {
+	opts := ParseOptions{Backslashes: true}
+	cases := map[string]string{
+		`\dms3fs\QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n\a\b`: "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b",
+		`QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n\a/b\`:        "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b",
+	}
+
+	for s, expected := range cases {
+		p, err := ParsePathWithOptions(s, opts)
+		if err != nil {
+			t.Fatalf("failed to parse %q with backslashes enabled: %s", s, err)
+		}
+		if p.String() != expected {
+			t.Fatalf("expected %q to parse to %s, not %s", s, expected, p)
+		}
+	}
+
+	// without the option, backslashes are part of the segments
+	if _, err := ParsePathWithOptions(`\dms3fs\QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n\a`, ParseOptions{}); err == nil {
+		t.Fatal("expected a backslash separated path to be rejected without the option")
+	}
+	p, err := ParsePathWithOptions(`/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a\b`, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segs := p.Segments(); segs[len(segs)-1] != `a\b` {
+		t.Fatalf("expected the backslash to be kept within the segment, got %q", segs)
+	}
+}
+
+func TestRootSet(t *testing.T) {
+	v0, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+	other, err := cid.Decode("QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := RootSet([]Path{
+		JoinCidAndRest(v0, []string{"a"}),
+		JoinCidAndRest(v0, []string{"b"}),
+		FromCid(other),
+		FromString("/dms3fs/" + v1.String() + "/c"),
+		FromString("/dms3ld/" + other.String() + "/d"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || !roots[0].Equals(v0) || !roots[1].Equals(other) {
+		t.Fatalf("expected [%s %s], got %v", v0, other, roots)
+	}
+
+	if roots, err := RootSet(nil); err != nil || len(roots) != 0 {
+		t.Fatalf("expected no roots for no paths, got %v and %v", roots, err)
+	}
+	if _, err := RootSet([]Path{FromCid(v0), "/dms3ns/example.com"}); err == nil {
+		t.Fatal("expected a dms3ns path to fail")
+	}
+}
+
+func TestSameRoot(t *testing.T) {
+	v0, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b")
+	cases := map[Path]bool{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":     true,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/c/d": true,
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/c":           true,
+		FromString("/dms3fs/" + v1.String() + "/c"):                  true,
+		"/dms3fs/QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX/a/b": false,
+		"/dms3ns/example.com/a/b":                                    false,
+		"/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/c":   true,
+		"/dms3ns/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b": false,
+	}
+
+	for other, expected := range cases {
+		if same := p.SameRoot(other); same != expected {
+			t.Fatalf("expected SameRoot(%s, %s) to be %t", p, other, expected)
+		}
+	}
+
+	if !MustParse("/dms3ns/example.com/a").SameRoot("/dms3ns/example.com/b") {
+		t.Fatal("expected paths under the same name to have the same root")
+	}
+}
+
+func TestCollidesWith(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	p := FromString(root + "/dir/File.txt")
+	for _, tc := range []struct {
+		other       Path
+		insensitive bool
+		sensitive   bool
+	}{
+		{FromString(root + "/dir/File.txt"), true, true},
+		{FromString(root + "/dir/file.txt"), true, false},
+		{FromString(root + "/DIR/FILE.TXT"), true, false},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dir/file.txt", true, false},
+		{FromString(root + "/dir/File.txt.bak"), false, false},
+		{FromString(root + "/other/File.txt"), false, false},
+		{FromString(root + "/dir"), false, false},
+		{"/dms3fs/QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX/dir/File.txt", false, false},
+		{"/dms3ns/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dir/File.txt", false, false},
+	} {
+		if got := p.CollidesWith(tc.other, true); got != tc.insensitive {
+			t.Fatalf("expected %s to collide with %s case-insensitively: %t", p, tc.other, tc.insensitive)
+		}
+		if got := p.CollidesWith(tc.other, false); got != tc.sensitive {
+			t.Fatalf("expected %s to collide with %s case-sensitively: %t", p, tc.other, tc.sensitive)
+		}
+	}
+}
+
+func TestToLowerSegments(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	cases := map[Path]Path{
+		FromString(root + "/Dir/File.TXT"):                 FromString(root + "/dir/file.txt"),
+		FromString(root):                                   FromString(root),
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/A": "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a",
+		"/dms3ns/Example.COM/Index.HTML":                   "/dms3ns/Example.COM/index.html",
+	}
+
+	for p, expected := range cases {
+		if lower := p.ToLowerSegments(); lower != expected {
+			t.Fatalf("expected %s to become %s, got %s", p, expected, lower)
+		}
+	}
+}
+
+func TestSegmentDistance(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/api/index.html")
+
+	cases := map[Path]int{
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/api/index.html":    0,
+		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/api/index.html":            0,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/apis/index.html":   1,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/index.html":        1,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/api/v1/index.html": 1,
+		"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":                        3,
+		"/dms3fs/QmYJEVm1nF1U2GgAzcwQBf3zdS8o5aoXwaSjTVNDgAtPbX/docs/api/index.html":    math.MaxInt32,
+		"/dms3ns/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/docs/api/index.html":    math.MaxInt32,
+	}
+
+	for other, expected := range cases {
+		if d := SegmentDistance(p, other); d != expected {
+			t.Fatalf("expected SegmentDistance(%s, %s) to be %d, not %d", p, other, expected, d)
+		}
+		if d := SegmentDistance(other, p); d != expected {
+			t.Fatalf("expected SegmentDistance(%s, %s) to be %d, not %d", other, p, expected, d)
+		}
+	}
+}
+
+func TestTrimProtocol(t *testing.T) {
+	c := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	cases := map[Path][]string{
+		Path("/dms3fs/" + c + "/a/b"): {c, "a", "b"},
+		Path("/dms3ld/" + c + "/a"):   {c, "a"},
+		Path("/dms3ns/example.com/a"): {"example.com", "a"},
+		Path("/dms3fs/" + c):          {c},
+		Path(c):                       {c},
+		Path(c + "/a"):                {c, "a"},
+	}
+
+	for p, expected := range cases {
+		segs := p.TrimProtocol()
+		if strings.Join(segs, "/") != strings.Join(expected, "/") {
+			t.Fatalf("expected TrimProtocol(%s) to return %q, not %q", p, expected, segs)
+		}
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	// in tree order, siblings shortest first
+	ordered := []Path{
+		FromString(root),
+		FromString(root + "/a"),
+		FromString(root + "/a/x"),
+		FromString(root + "/a/x/y"),
+		FromString(root + "/a/z"),
+		FromString(root + "/b"),
+		FromString(root + "/ab"),
+		FromString(root + "/ab/c"),
+		"/dms3ns/example.com",
+		"/dms3ns/example.com/a",
+	}
+
+	shuffled := make([]Path, len(ordered))
+	for i, j := range []int{7, 2, 9, 0, 5, 3, 8, 1, 6, 4} {
+		shuffled[i] = ordered[j]
+	}
+	sort.Slice(shuffled, func(i, j int) bool {
+		return bytes.Compare(shuffled[i].SortKey(), shuffled[j].SortKey()) < 0
+	})
+	for i := range ordered {
+		if shuffled[i] != ordered[i] {
+			t.Fatalf("expected %s at position %d, got %s", ordered[i], i, shuffled[i])
+		}
+	}
+
+	a := FromString(root + "/a").SortKey()
+	if !bytes.HasPrefix(FromString(root+"/a/x/y").SortKey(), a) {
+		t.Fatal("expected the key of a path to prefix the keys below it")
+	}
+	if bytes.HasPrefix(FromString(root+"/ab").SortKey(), a) {
+		t.Fatal("expected the key of a path not to prefix the keys of its siblings")
+	}
+
+	if !bytes.Equal(Path("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a").SortKey(), a) {
+		t.Fatal("expected a bare cid path to have the same key as its prefixed form")
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	v0 := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	c, err := cid.Decode(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, c.Hash()).String()
+
+	for _, p := range []string{
+		"/dms3fs/" + v0,
+		"/dms3fs/" + v0 + "/a/b/c",
+		"/dms3ld/" + v1 + "/a",
+		"/dms3ns/example.com/a/b",
+	} {
+		data, err := FromString(p).MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+
+		var out Path
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+		if out.String() != p {
+			t.Fatalf("expected %s to round-trip, got %s", p, out)
+		}
+	}
+
+	deep := "/dms3fs/" + v0 + strings.Repeat("/segment", 20)
+	data, err := FromString(deep).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(deep) {
+		t.Fatalf("expected the binary form (%d bytes) to be shorter than the text form (%d bytes)", len(data), len(deep))
+	}
+
+	var out Path
+	if err := out.UnmarshalBinary(data[:len(data)-3]); err == nil {
+		t.Fatal("expected truncated data to fail to unmarshal")
+	}
+	if err := out.UnmarshalBinary([]byte{4, 'n', 'o', 'p', 'e', 1, 'x'}); err == nil {
+		t.Fatal("expected an unknown protocol to fail to unmarshal")
+	}
+	if _, err := FromString("/nope").MarshalBinary(); err == nil {
+		t.Fatal("expected an invalid path to fail to marshal")
+	}
+}
+
+func TestReadPath(t *testing.T) {
+	txt := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"
+
+	p, err := ReadPath(strings.NewReader(txt + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != txt {
+		t.Fatalf("expected %s, got %s", txt, p)
+	}
+
+	if _, err := ReadPath(strings.NewReader(txt + "\nextra\n")); err == nil {
+		t.Fatal("expected trailing garbage to be an error")
+	}
+	if _, err := ReadPath(strings.NewReader("\n")); err == nil {
+		t.Fatal("expected an empty input to be an error")
+	}
+}
+
+func TestParsePathWithDiagnostics(t *testing.T) {
+	v0 := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	c, err := cid.Decode(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, c.Hash()).String()
+
+	p, warnings, err := ParsePathWithDiagnostics(v0 + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "/dms3fs/"+v0+"/a" {
+		t.Fatalf("unexpected path %s", p)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "bare cid") || !strings.Contains(warnings[1], "CIDv0") {
+		t.Fatalf("expected bare cid and CIDv0 warnings, got %q", warnings)
+	}
+
+	_, warnings, err = ParsePathWithDiagnostics("/dms3fs/" + v1 + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings for a canonical path, got %q", warnings)
+	}
+
+	_, warnings, err = ParsePathWithDiagnostics("/dms3fs/" + v1 + "//a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected a warning about cleaning, got %q", warnings)
+	}
+
+	if _, _, err := ParsePathWithDiagnostics("/nope"); err == nil {
+		t.Fatal("expected an invalid path to fail")
+	}
+}
+
+func TestClone(t *testing.T) {
+	// a path sliced from a larger string, which it keeps in memory
+	buf := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a and more"
+	p := Path(buf[:len(buf)-len(" and more")])
+
+	c := p.Clone()
+	if c != p {
+		t.Fatalf("expected the clone %s to equal %s", c, p)
+	}
+	if stringData(string(c)) == stringData(string(p)) {
+		t.Fatal("expected the clone not to share memory with the original")
+	}
+}
+
+// stringData returns the address of the bytes of s.
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestJoinCidAndRest(t *testing.T) {
+	c, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		rest     []string
+		expected string
+	}{
+		{nil, "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"},
+		{[]string{"a", "b"}, "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b"},
+		{[]string{"", "a", ""}, "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"},
+	} {
+		if p := JoinCidAndRest(c, tc.rest); p.String() != tc.expected {
+			t.Fatalf("expected %s, got %s", tc.expected, p)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		in   string
+		dir  string
+		file string
+	}{
+		{root, root, ""},
+		{root + "/a", root, "a"},
+		{root + "/a/b", root + "/a", "b"},
+		{root + "/a/b/", root + "/a", "b"},
+		{"/dms3ns/example.com/a", "/dms3ns/example.com", "a"},
+		{"/nope/a", "/nope/a", ""},
+	} {
+		dir, file := Split(FromString(tc.in))
+		if dir.String() != tc.dir || file != tc.file {
+			t.Fatalf("Split(%s): expected (%s, %q), got (%s, %q)", tc.in, tc.dir, tc.file, dir, file)
+		}
+	}
+}
+
+func TestParseAny(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		in       string
+		expected string
+	}{
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n", root},
+		{root + "/a", root + "/a"},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a", root + "/a"},
+		{"https://gateway.example.com" + root + "/a%20b?download=true", root + "/a b"},
+		{" example.com\n", "/dms3ns/example.com"},
+	} {
+		p, err := ParseAny(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.in, err)
+		}
+		if p.String() != tc.expected {
+			t.Fatalf("%q: expected %s, got %s", tc.in, tc.expected, p)
+		}
+	}
+
+	for _, in := range []string{"", "ftp://example.com" + root, "not a path"} {
+		if p, err := ParseAny(in); err == nil {
+			t.Fatalf("expected %q to fail to parse, got %s", in, p)
+		}
+	}
+}
+
+func TestParseVersionedPath(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		in      string
+		path    string
+		version string
+	}{
+		{root + "/a/b@v3", root + "/a/b", "v3"},
+		{root + "/a/b@2018-06-01_1", root + "/a/b", "2018-06-01_1"},
+		{root + "@v1", root, "v1"},
+		{root + "/a/b", root + "/a/b", ""},
+		{root + "/a@v1/b", root + "/a@v1/b", ""},
+		{root + "/a/user@example.com", root + "/a/user@example.com", ""},
+		{root + "/a/b@", root + "/a/b@", ""},
+		{root + "/a/@v3", root + "/a/@v3", ""},
+	} {
+		p, version, err := ParseVersionedPath(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.in, err)
+		}
+		if p.String() != tc.path || version != tc.version {
+			t.Fatalf("%s: expected %s and %q, got %s and %q", tc.in, tc.path, tc.version, p, version)
+		}
+	}
+
+	if _, _, err := ParseVersionedPath("/dms3fs/nope@v3"); err == nil {
+		t.Fatal("expected an invalid path with a version to fail")
+	}
+}
+
+func TestParsePathDetailed(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		in       string
+		prefixed bool
+	}{
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n", true},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a", true},
+		{root, false},
+		{root + "/a", false},
+	} {
+		p, prefixed, err := ParsePathDetailed(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.in, err)
+		}
+		if !strings.HasPrefix(p.String(), root) {
+			t.Fatalf("%s: unexpected path %s", tc.in, p)
+		}
+		if prefixed != tc.prefixed {
+			t.Fatalf("%s: expected prefixed to be %t", tc.in, tc.prefixed)
+		}
+	}
+
+	if _, prefixed, err := ParsePathDetailed("nope"); err == nil || prefixed {
+		t.Fatal("expected an invalid path to fail without being prefixed")
+	}
+}
+
+func TestParsePathNormalizeSegment(t *testing.T) {
+	// a stand-in for NFC normalization, composing a single character
+	nfc := func(s string) string {
+		return strings.Replace(s, "e\u0301", "\u00e9", -1)
+	}
+	opts := ParseOptions{NormalizeSegment: nfc}
+
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	composed, err := ParsePathWithOptions(root+"/caf\u00e9/a", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposed, err := ParsePathWithOptions(root+"/cafe\u0301/a", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if composed != decomposed {
+		t.Fatalf("expected %q and %q to be equal", composed, decomposed)
+	}
+	if plain := MustParse(root + "/cafe\u0301/a"); plain == composed {
+		t.Fatal("expected segments not to be normalized by default")
+	}
+
+	// the root is left alone even when the normalizer would change it
+	upper := ParseOptions{NormalizeSegment: strings.ToUpper}
+	p, err := ParsePathWithOptions(root+"/a", upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != root+"/A" {
+		t.Fatalf("expected only the segments to be normalized, got %s", p)
+	}
+}
+
+func TestParsePathRequireCanonicalCid(t *testing.T) {
+	v0, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+	strict := ParseOptions{RequireCanonicalCid: true}
+
+	for _, txt := range []string{
+		"/dms3fs/" + v0.String() + "/a",
+		"/dms3ld/" + v1.String() + "/a",
+		v1.String(),
+		"/dms3ns/example.com/a",
+	} {
+		if _, err := ParsePathWithOptions(txt, strict); err != nil {
+			t.Fatalf("%s: %s", txt, err)
+		}
+	}
+
+	f := "f" + hex.EncodeToString(v1.Bytes())
+	if _, err := ParsePathWithOptions("/dms3fs/"+f+"/a", ParseOptions{}); err != nil {
+		t.Fatalf("expected a hex cid to be accepted by default, got %s", err)
+	}
+	for _, txt := range []string{"/dms3fs/" + f + "/a", f} {
+		if _, err := ParsePathWithOptions(txt, strict); err != ErrNonCanonicalCid {
+			t.Fatalf("%s: expected ErrNonCanonicalCid, got %v", txt, err)
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, p := range []Path{
+		FromString(root),
+		FromString(root + "//a/b/"),
+		FromString("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"),
+		FromString(root + "/" + strings.Repeat("x", 300)),
+		FromString("/dms3ns/example.com/a"),
+	} {
+		if l := p.EncodedLen(); l != len(MustParse(string(p))) {
+			t.Fatalf("%s: unexpected encoded length %d", p, l)
+		}
+
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l := p.BinaryLen(); l != len(data) {
+			t.Fatalf("%s: expected a binary length of %d, got %d", p, len(data), l)
+		}
+	}
+
+	if l := FromString("/nope").BinaryLen(); l != 0 {
+		t.Fatalf("expected an invalid path to have no binary length, got %d", l)
+	}
+}
+
+func TestHasSegment(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/src/.git/config")
+
+	if !p.HasSegment(".git") {
+		t.Fatal("expected .git to be a segment")
+	}
+	if p.HasSegment("docs") {
+		t.Fatal("expected docs not to be a segment")
+	}
+	if p.HasSegment("git") || p.HasSegment("conf") {
+		t.Fatal("expected parts of segments not to match")
+	}
+	if p.HasSegment("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n") || p.HasSegment("dms3fs") {
+		t.Fatal("expected the protocol and root not to match")
+	}
+}
+
+func TestCheckResolvable(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, p := range []string{root, root + "/a/b", "/dms3ld/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"} {
+		if err := FromString(p).CheckResolvable(); err != nil {
+			t.Fatalf("expected %s to be resolvable, got %s", p, err)
+		}
+	}
+
+	err := FromString("/dms3ns/example.com/a").CheckResolvable()
+	if err != (ErrNotCidRooted{Protocol: "dms3ns"}) {
+		t.Fatalf("expected ErrNotCidRooted, got %v", err)
+	}
+
+	err = FromString("/dms3ld/notacid/a").CheckResolvable()
+	if e, ok := err.(ErrInvalidSegment); !ok || e.Index != 0 || e.Segment != "notacid" {
+		t.Fatalf("expected an invalid root, got %v", err)
+	}
+
+	if err := FromString("/dms3fs/").CheckResolvable(); err != ErrNoComponents {
+		t.Fatalf("expected ErrNoComponents, got %v", err)
+	}
+	if err := FromString(root + "/a\x00").CheckResolvable(); err == nil {
+		t.Fatal("expected an illegal character to be reported")
+	}
+}
+
+func TestRootString(t *testing.T) {
+	v0 := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	c, err := cid.Decode(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, c.Hash())
+
+	for _, tc := range []struct {
+		in       string
+		expected string
+	}{
+		{"/dms3fs/" + v0 + "/a/b", v0},
+		{v0, v0},
+		{"/dms3ld/" + v1.String() + "/a", v1.String()},
+		{"/dms3fs/f" + hex.EncodeToString(v1.Bytes()) + "/a", v1.String()},
+	} {
+		root, err := FromString(tc.in).RootString()
+		if err != nil {
+			t.Fatalf("%s: %s", tc.in, err)
+		}
+		if root != tc.expected {
+			t.Fatalf("%s: expected %s, got %s", tc.in, tc.expected, root)
+		}
+	}
+
+	_, err = FromString("/dms3ns/example.com/a").RootString()
+	if err != (ErrNotCidRooted{Protocol: "dms3ns"}) {
+		t.Fatalf("expected ErrNotCidRooted, got %v", err)
+	}
+	if _, err := FromString("/nope").RootString(); err == nil {
+		t.Fatal("expected an invalid path to fail")
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		dir      string
+		name     string
+		expected string
+	}{
+		{root + "/site", "", root + "/site/index.html"},
+		{root + "/site/", "", root + "/site/index.html"},
+		{root, "index.htm", root + "/index.htm"},
+	} {
+		p, err := FromString(tc.dir).IndexFile(tc.name)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.dir, err)
+		}
+		if p.String() != tc.expected {
+			t.Fatalf("%s: expected %s, got %s", tc.dir, tc.expected, p)
+		}
+	}
+
+	if _, err := FromString(root).IndexFile("a/index.html"); err == nil {
+		t.Fatal("expected a name with a slash to be rejected")
+	}
+	if _, err := FromString("/nope").IndexFile(""); err == nil {
+		t.Fatal("expected an invalid directory to be rejected")
+	}
+}
+
+func TestMaxSegmentLength(t *testing.T) {
+	root := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	atLimit := strings.Repeat("x", MaxSegmentLength)
+	overLimit := atLimit + "x"
+
+	if _, err := ParsePath(root + "/a/" + atLimit); err != nil {
+		t.Fatalf("expected a segment at the limit to be accepted, got %s", err)
+	}
+	if err := ValidateSegment(atLimit); err != nil {
+		t.Fatalf("expected a segment at the limit to be valid, got %s", err)
+	}
+
+	_, err := ParsePath(root + "/a/" + overLimit + "/b")
+	if err != (ErrSegmentTooLong{Index: 3, Len: MaxSegmentLength + 1}) {
+		t.Fatalf("expected ErrSegmentTooLong for segment 3, got %v", err)
+	}
+	_, err = ParsePath("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/" + overLimit)
+	if err != (ErrSegmentTooLong{Index: 2, Len: MaxSegmentLength + 1}) {
+		t.Fatalf("expected ErrSegmentTooLong for segment 2 of a bare cid path, got %v", err)
+	}
+	if err := ValidateSegment(overLimit); err != (ErrSegmentTooLong{Len: MaxSegmentLength + 1}) {
+		t.Fatalf("expected ErrSegmentTooLong, got %v", err)
+	}
+
+	_, err = FromSegments("/dms3fs/", "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n", overLimit)
+	if e, ok := err.(ErrInvalidSegment); !ok || e.Index != 1 {
+		t.Fatalf("expected segment 1 to be invalid, got %v", err)
+	}
+
+	defer func(l int) { MaxSegmentLength = l }(MaxSegmentLength)
+	MaxSegmentLength = 0
+	if _, err := ParsePath(root + "/" + overLimit); err != nil {
+		t.Fatalf("expected no limit, got %s", err)
+	}
+}
+
+func TestJoinAll(t *testing.T) {
+	base := FromString("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dir")
+
+	paths, err := JoinAll(base, "a.txt", "sub/b.txt", "c/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/a.txt", "/sub/b.txt", "/c"}
+	if len(paths) != len(expected) {
+		t.Fatalf("expected %d paths, got %v", len(expected), paths)
+	}
+	for i := range expected {
+		if paths[i].String() != base.String()+expected[i] {
+			t.Fatalf("expected path %d to be %s, got %s", i, base.String()+expected[i], paths[i])
+		}
+	}
+
+	for _, bad := range []string{"", "/abs", "../escape", "a/./b"} {
+		_, err := JoinAll(base, "ok", bad)
+		if e, ok := err.(ErrInvalidSegment); !ok || e.Index != 1 || e.Segment != bad {
+			t.Fatalf("%q: expected relative path 1 to be invalid, got %v", bad, err)
+		}
+	}
+
+	if _, err := JoinAll(FromString("/nope"), "a"); err == nil {
+		t.Fatal("expected an invalid base to fail")
+	}
+}
+
+func TestEstimatedHops(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		hops int
+	}{
+		{"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n", 0},
+		{"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a", 1},
+		{"/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n//a/b/c/", 3},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b", 2},
+		{"/dms3ns/example.com/a/b", 2},
+	} {
+		if hops := FromString(tc.in).EstimatedHops(); hops != tc.hops {
+			t.Fatalf("%s: expected %d hops, got %d", tc.in, tc.hops, hops)
+		}
+	}
+}
+
+func TestURLComponents(t *testing.T) {
+	root := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, tc := range []struct {
+		in     string
+		scheme string
+		host   string
+		path   string
+	}{
+		{"/dms3fs/" + root + "/a/b", "dms3fs", root, "/a/b"},
+		{"/dms3fs/" + root, "dms3fs", root, ""},
+		{root + "/a", "dms3fs", root, "/a"},
+		{"/dms3ns/example.com/a/", "dms3ns", "example.com", "/a"},
+		{"/nope/a", "", "", ""},
+	} {
+		p := FromString(tc.in)
+		if p.Scheme() != tc.scheme || p.Host() != tc.host || p.PathPart() != tc.path {
+			t.Fatalf("%s: expected (%q, %q, %q), got (%q, %q, %q)", tc.in,
+				tc.scheme, tc.host, tc.path, p.Scheme(), p.Host(), p.PathPart())
+		}
+	}
+}
+
+func TestStripHost(t *testing.T) {
+	p := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"
+	for _, tc := range []struct {
+		in       string
+		expected string
+	}{
+		{"gateway.example" + p, p},
+		{"localhost:8080/dms3ns/example.com/a", "/dms3ns/example.com/a"},
+		{p, p},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a", "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a"},
+		{"gateway.example/other/path", "gateway.example/other/path"},
+		{"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dms3fs/x", "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/dms3fs/x"},
+		{"", ""},
+	} {
+		if out := StripHost(tc.in); out != tc.expected {
+			t.Fatalf("StripHost(%q): expected %q, got %q", tc.in, tc.expected, out)
+		}
+	}
+}
+
+func TestParsePathCid(t *testing.T) {
+	root := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	for _, in := range []string{
+		"/dms3fs/" + root + "/a/b",
+		root + "/a/b",
+		"/dms3ld/" + root + "/a/b",
+	} {
+		p, c, rest, err := ParsePathCid(in)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+
+		ep, err := ParsePath(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ec, erest, err := SplitAbsPath(ep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != ep || !c.Equals(ec) || strings.Join(rest, "/") != strings.Join(erest, "/") {
+			t.Fatalf("%s: expected (%s, %s, %q), got (%s, %s, %q)", in, ep, ec, erest, p, c, rest)
+		}
+	}
+
+	if _, _, rest, err := ParsePathCid(root); err != nil || len(rest) != 0 {
+		t.Fatalf("expected a bare cid to have no segments, got %q and %v", rest, err)
+	}
+	if _, _, _, err := ParsePathCid("/dms3ns/example.com/a"); err != (ErrNotCidRooted{Protocol: "dms3ns"}) {
+		t.Fatalf("expected ErrNotCidRooted, got %v", err)
+	}
+	if _, _, _, err := ParsePathCid("/nope"); err == nil {
+		t.Fatal("expected an invalid path to fail")
+	}
+}
+
+func BenchmarkParsePathCid(b *testing.B) {
+	txt := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := ParsePathCid(txt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParsePathThenSplitAbsPath(b *testing.B) {
+	txt := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a/b/c"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p, err := ParsePath(txt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := SplitAbsPath(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDNSLinkRecord(t *testing.T) {
+	p := "/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/site"
+
+	rec, err := FromString(p + "/").DNSLinkRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec != "dnslink="+p {
+		t.Fatalf("unexpected record %s", rec)
+	}
+
+	if _, err := FromString("/dms3ns/example.com").DNSLinkRecord(); err != (ErrNotCidRooted{Protocol: "dms3ns"}) {
+		t.Fatalf("expected ErrNotCidRooted, got %v", err)
+	}
+	if _, err := FromString("/nope").DNSLinkRecord(); err == nil {
+		t.Fatal("expected an invalid path to fail")
+	}
+}
+
+func TestURLEncode(t *testing.T) {
+	p := MustParse("/dms3fs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a dir/b?c#d%e")
+
+	enc := p.URLEncode()
+	if strings.ContainsAny(enc, "/ ?#") {
+		t.Fatalf("expected %q to be a single safe path segment", enc)
+	}
+	dec, err := URLDecode(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != p {
+		t.Fatalf("expected %s to round-trip, got %s", p, dec)
+	}
+
+	u, err := url.Parse("https://viewer.example/view/" + enc + "/raw?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := strings.Split(u.EscapedPath(), "/")
+	if len(segs) != 4 || segs[3] != "raw" {
+		t.Fatalf("expected the path to stay a single segment, got %q", segs)
+	}
+	dec, err = URLDecode(segs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != p {
+		t.Fatalf("expected %s to be extracted, got %s", p, dec)
+	}
+
+	if _, err := URLDecode("%zz"); err == nil {
+		t.Fatal("expected a bad escape to fail")
+	}
+}
+
+func TestKnownProtocols(t *testing.T) {
+	if err := RegisterProtocol("dms3kp", true); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterProtocol("dms3kp")
+
+	known := KnownProtocols()
+	for _, proto := range []string{"dms3fs", "dms3ld", "dms3ns", "dms3kp"} {
+		found := false
+		for _, k := range known {
+			found = found || k == proto
+		}
+		if !found {
+			t.Fatalf("expected %s to be known, got %q", proto, known)
+		}
+	}
+	for i := 1; i < len(known); i++ {
+		if known[i-1] >= known[i] {
+			t.Fatalf("expected sorted protocols, got %q", known)
+		}
+	}
+}
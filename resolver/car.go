@@ -0,0 +1,148 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	path "github.com/dms3-fs/go-path"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ResolveCAR resolves fpath and writes a CARv1 stream to w, rooted at the
+// resolved node and holding the blocks of every node reachable from it.
+// Blocks are written as they are fetched, each one once, so memory use
+// doesn't grow with the size of the blocks.
+func (r *Resolver) ResolveCAR(ctx context.Context, fpath path.Path, w io.Writer) error {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCARHeader(w, nd.Cid()); err != nil {
+		return err
+	}
+	return r.writeCARSubtree(ctx, w, nd, make(map[string]bool), r.newProgress(-1))
+}
+
+// ResolveCARPath resolves fpath and writes a CARv1 stream to w, rooted at
+// the root of fpath and holding only the blocks of the nodes on the way to
+// the resolved node, included. This is what is needed to resolve fpath
+// again offline.
+func (r *Resolver) ResolveCARPath(ctx context.Context, fpath path.Path, w io.Writer) error {
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCARHeader(w, nodes[0].Cid()); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	prog := r.newProgress(len(nodes))
+	for _, nd := range nodes {
+		if k := contentKey(nd.Cid()); !seen[k] {
+			seen[k] = true
+			if err := writeCARBlock(w, nd); err != nil {
+				return err
+			}
+		}
+		prog.step()
+	}
+	return nil
+}
+
+func (r *Resolver) writeCARSubtree(ctx context.Context, w io.Writer, nd dms3ld.Node, seen map[string]bool, prog *progress) error {
+	k := contentKey(nd.Cid())
+	if seen[k] {
+		return nil
+	}
+	seen[k] = true
+
+	if err := writeCARBlock(w, nd); err != nil {
+		return err
+	}
+	prog.step()
+
+	for _, lnk := range nd.Links() {
+		if seen[contentKey(lnk.Cid)] {
+			continue
+		}
+		child, err := r.getNode(ctx, lnk.Cid, nil)
+		if err != nil {
+			return err
+		}
+		if err := r.writeCARSubtree(ctx, w, child, seen, prog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCARHeader writes the header of a CARv1 stream with the given root:
+// the length prefixed dag-cbor encoding of {"roots": [root], "version": 1}.
+func writeCARHeader(w io.Writer, root *cid.Cid) error {
+	// cids are encoded as tag 42 over their binary form prefixed with 0x00
+	link := append([]byte{0}, root.Bytes()...)
+
+	var hdr []byte
+	hdr = appendCBORHead(hdr, 5, 2) // map of 2
+	hdr = appendCBORHead(hdr, 3, 5) // "roots"
+	hdr = append(hdr, "roots"...)
+	hdr = appendCBORHead(hdr, 4, 1) // array of 1
+	hdr = appendCBORHead(hdr, 6, 42)
+	hdr = appendCBORHead(hdr, 2, uint64(len(link)))
+	hdr = append(hdr, link...)
+	hdr = appendCBORHead(hdr, 3, 7) // "version"
+	hdr = append(hdr, "version"...)
+	hdr = appendCBORHead(hdr, 0, 1)
+
+	return writeCARSection(w, hdr)
+}
+
+// writeCARBlock writes the section of a CARv1 stream holding nd.
+func writeCARBlock(w io.Writer, nd dms3ld.Node) error {
+	return writeCARSection(w, nd.Cid().Bytes(), nd.RawData())
+}
+
+// writeCARSection writes the concatenation of parts, prefixed by its length
+// as an unsigned varint.
+func writeCARSection(w io.Writer, parts ...[]byte) error {
+	var size int
+	for _, p := range parts {
+		size += len(p)
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(size))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendCBORHead appends the head of a CBOR data item of the given major
+// type and argument to b.
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= 0xff:
+		return append(b, major|24, byte(arg))
+	case arg <= 0xffff:
+		return append(b, major|25, byte(arg>>8), byte(arg))
+	case arg <= 0xffffffff:
+		return append(b, major|26, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], arg)
+	return append(append(b, major|27), buf[:]...)
+}
@@ -0,0 +1,97 @@
+package resolver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// readCAR splits a CARv1 stream into its header and block sections.
+func readCAR(t *testing.T, car []byte) ([]byte, [][]byte) {
+	var sections [][]byte
+	for len(car) > 0 {
+		size, n := binary.Uvarint(car)
+		if n <= 0 || uint64(len(car)-n) < size {
+			t.Fatal("malformed CAR section")
+		}
+		sections = append(sections, car[n:n+int(size)])
+		car = car[n+int(size):]
+	}
+	if len(sections) == 0 {
+		t.Fatal("empty CAR")
+	}
+	return sections[0], sections[1:]
+}
+
+func carHeader(root *cid.Cid) []byte {
+	hdr := []byte{0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0xd8, 0x2a, 0x58, byte(len(root.Bytes()) + 1), 0}
+	hdr = append(hdr, root.Bytes()...)
+	return append(hdr, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+}
+
+func assertCAR(t *testing.T, car []byte, root *cid.Cid, nodes ...dms3ld.Node) {
+	hdr, blocks := readCAR(t, car)
+	if !bytes.Equal(hdr, carHeader(root)) {
+		t.Fatalf("unexpected CAR header %x", hdr)
+	}
+	if len(blocks) != len(nodes) {
+		t.Fatalf("expected %d blocks, got %d", len(nodes), len(blocks))
+	}
+	for i, nd := range nodes {
+		expected := append(nd.Cid().Bytes(), nd.RawData()...)
+		if !bytes.Equal(blocks[i], expected) {
+			t.Fatalf("expected block %d to be %s", i, nd.Cid())
+		}
+	}
+}
+
+func TestResolveCAR(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	other := randNode()
+	root := randNode()
+	for name, nd := range map[string]dms3ld.Node{"child": nodes[1], "other": other, "again": nodes[2]} {
+		if err := root.AddNodeLink(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, nd := range []dms3ld.Node{root, other} {
+		if err := dagService.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+
+	var buf bytes.Buffer
+	if err := r.ResolveCAR(ctx, path.FromCid(root.Cid()), &buf); err != nil {
+		t.Fatal(err)
+	}
+	// links are visited in order: again, child, other
+	assertCAR(t, buf.Bytes(), root.Cid(), root, nodes[2], nodes[1], other)
+
+	p, err := path.FromSegments("/dms3fs/", root.Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := r.ResolveCARPath(ctx, p, &buf); err != nil {
+		t.Fatal(err)
+	}
+	assertCAR(t, buf.Bytes(), root.Cid(), root, nodes[1], nodes[2])
+
+	buf.Reset()
+	if err := r.ResolveCAR(ctx, p, &buf); err != nil {
+		t.Fatal(err)
+	}
+	assertCAR(t, buf.Bytes(), nodes[2].Cid(), nodes[2])
+}
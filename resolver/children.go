@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	path "github.com/dms3-fs/go-path"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ErrChildren is returned by ResolveChildren when some of the children
+// couldn't be resolved. It maps their names to the error each one failed
+// with.
+type ErrChildren map[string]error
+
+// Error implements the Error interface for ErrChildren.
+func (e ErrChildren) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e[name].Error()
+	}
+	return "failed to resolve children: " + strings.Join(msgs, "; ")
+}
+
+// ResolveChildren resolves parent once, then resolves each of the given
+// names under it concurrently. It returns the nodes found, keyed by name.
+// When some names fail to resolve, the others are still returned, along
+// with an ErrChildren.
+func (r *Resolver) ResolveChildren(ctx context.Context, parent path.Path, names []string) (map[string]dms3ld.Node, error) {
+	nd, err := r.ResolvePath(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	var lk sync.Mutex
+	var wg sync.WaitGroup
+	children := make(map[string]dms3ld.Node, len(names))
+	errs := make(ErrChildren)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			nodes, err := r.ResolveLinks(ctx, nd, []string{name})
+
+			lk.Lock()
+			defer lk.Unlock()
+			if err != nil {
+				errs[name] = err
+				return
+			}
+			children[name] = nodes[len(nodes)-1]
+		}(name)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return children, errs
+	}
+	return children, nil
+}
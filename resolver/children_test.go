@@ -0,0 +1,43 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+)
+
+func TestResolveChildren(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	root := randNode()
+	if err := root.AddNodeLink("b", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("c", nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	children, err := r.ResolveChildren(ctx, path.FromCid(root.Cid()), []string{"b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || !children["b"].Cid().Equals(nodes[1].Cid()) || !children["c"].Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("unexpected children %v", children)
+	}
+
+	children, err = r.ResolveChildren(ctx, path.FromCid(root.Cid()), []string{"b", "missing"})
+	errs, ok := err.(resolver.ErrChildren)
+	if !ok || len(errs) != 1 || errs["missing"] == nil {
+		t.Fatalf("expected the missing child to be reported, got %v", err)
+	}
+	if len(children) != 1 || !children["b"].Cid().Equals(nodes[1].Cid()) {
+		t.Fatalf("expected the other child to be resolved, got %v", children)
+	}
+}
@@ -0,0 +1,45 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	cid "github.com/dms3-fs/go-cid"
+)
+
+// sha2-256 multihash code and digest length, the only hash CIDv0 allows.
+const (
+	sha256Code = 0x12
+	sha256Len  = 32
+)
+
+// sameContent reports whether a and b address the same block interpreted
+// the same way, i.e. have the same codec and multihash. Unlike Equals, a
+// CIDv0 and the CIDv1 of the same dag-pb block are the same content.
+func sameContent(a, b *cid.Cid) bool {
+	return a.Type() == b.Type() && bytes.Equal(a.Hash(), b.Hash())
+}
+
+// contentKey returns a map key for c which only depends on its codec and
+// multihash, so both cid versions of a block share the same key.
+func contentKey(c *cid.Cid) string {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], c.Type())
+	return string(buf[:n]) + string(c.Hash())
+}
+
+// otherVersion returns the cid of the other version addressing the same
+// content as c, or nil when c cannot be expressed as a CIDv0.
+func otherVersion(c *cid.Cid) *cid.Cid {
+	if c.Type() != cid.DagProtobuf {
+		return nil
+	}
+	if c.Version() == 0 {
+		return cid.NewCidV1(cid.DagProtobuf, c.Hash())
+	}
+	pref := c.Prefix()
+	if pref.MhType != sha256Code || pref.MhLength != sha256Len {
+		return nil
+	}
+	return cid.NewCidV0(c.Hash())
+}
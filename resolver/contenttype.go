@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	gopath "path"
+
+	path "github.com/dms3-fs/go-path"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// DirectoryContentType is the content type ResolveContentType returns for
+// directories.
+const DirectoryContentType = "inode/directory"
+
+// ResolveContentType resolves fpath and returns a best-effort content type
+// for it. UnixFS directories, and dag-pb nodes without UnixFS data whose
+// links are all named, are directories. For files, the extension of the
+// last segment is used first. Failing that, their leading bytes are sniffed
+// with http.DetectContentType: the data of a raw node, or that of a UnixFS
+// file, read from its first chunk when the file node holds none itself.
+// Other nodes are reported as application/octet-stream.
+func (r *Resolver) ResolveContentType(ctx context.Context, fpath path.Path) (string, error) {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return "", err
+	}
+	return r.contentType(ctx, fpath, nd, true)
+}
+
+// contentType implements ResolveContentType given the node fpath resolved
+// to. Unless fetch is set, only the data held by nd itself is sniffed.
+func (r *Resolver) contentType(ctx context.Context, fpath path.Path, nd dms3ld.Node, fetch bool) (string, error) {
+	if isDir(nd) {
+		return DirectoryContentType, nil
+	}
+
+	if ext := gopath.Ext(fpath.String()); ext != "" {
+		if ct := mime.TypeByExtension(ext); ct != "" {
+			return ct, nil
+		}
+	}
+
+	data, ok, err := r.leadingData(ctx, nd, fetch)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "application/octet-stream", nil
+	}
+	if len(data) > 512 {
+		data = data[:512]
+	}
+	return http.DetectContentType(data), nil
+}
+
+// isDir tells whether nd is a UnixFS directory or, lacking UnixFS data, a
+// dag-pb node whose links are all named.
+func isDir(nd dms3ld.Node) bool {
+	if d, ok := decodeUnixFS(nd); ok {
+		return d.Type == unixfsDirectory || d.Type == unixfsHAMTShard
+	}
+
+	links := nd.Links()
+	for _, lnk := range links {
+		if lnk.Name == "" {
+			return false
+		}
+	}
+	return nd.Cid().Type() == cid.DagProtobuf && len(links) > 0
+}
+
+// leadingData returns the first bytes of the file nd: the data of a raw
+// node, or that of a UnixFS file, going down its first links until data is
+// found when fetch is set. ok is false when nd isn't a file, or its data
+// would have to be fetched.
+func (r *Resolver) leadingData(ctx context.Context, nd dms3ld.Node, fetch bool) (data []byte, ok bool, err error) {
+	for {
+		if nd.Cid().Type() == cid.Raw {
+			return nd.RawData(), true, nil
+		}
+		d, ok := decodeUnixFS(nd)
+		if !ok || d.Type != unixfsFile && d.Type != unixfsRaw {
+			return nil, false, nil
+		}
+		links := nd.Links()
+		if len(d.Data) > 0 || len(links) == 0 {
+			return d.Data, true, nil
+		}
+		if !fetch {
+			return nil, false, nil
+		}
+
+		nd, err = r.getNode(ctx, links[0].Cid, nil)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package resolver_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+	dagmock "github.com/dms3-fs/go-merkledag/test"
+)
+
+func TestResolveContentType(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	dir := randNode()
+	jsonFile := merkledag.NewRawNode([]byte(`{"a": 1}`))
+	textFile := merkledag.NewRawNode([]byte("just some text\n"))
+	// UnixFS files, holding their data or chunked
+	pbFile := unixfsNode(2, []byte("just some text\n"), 0)
+	chunk := merkledag.NewRawNode([]byte("<html><body>hi</body></html>"))
+	chunked := unixfsNode(2, nil, 0)
+	if err := chunked.AddNodeLink("", chunk); err != nil {
+		t.Fatal(err)
+	}
+	emptyDir := unixfsNode(1, nil, 0)
+	if err := dir.AddNodeLink("data.json", jsonFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("README", textFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("NOTES", pbFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("page", chunked); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("empty", emptyDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{dir, jsonFile, textFile, pbFile, chunk, chunked, emptyDir} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	for _, tc := range []struct {
+		name     string
+		expected string
+	}{
+		{"data.json", "application/json"},
+		{"README", "text/plain"},
+		{"NOTES", "text/plain"},
+		{"page", "text/html"},
+		{"empty", resolver.DirectoryContentType},
+		{"", resolver.DirectoryContentType},
+	} {
+		p := path.FromCid(dir.Cid())
+		if tc.name != "" {
+			p = path.FromString(p.String() + "/" + tc.name)
+		}
+
+		ct, err := r.ResolveContentType(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(ct, tc.expected) {
+			t.Fatalf("%s: expected %s, got %s", p, tc.expected, ct)
+		}
+	}
+}
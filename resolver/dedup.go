@@ -0,0 +1,33 @@
+package resolver
+
+import (
+	"context"
+
+	path "github.com/dms3-fs/go-path"
+)
+
+// DedupByCid resolves each of paths with r and groups them by the cid of
+// the node they resolve to, keyed by its string form, in the order they
+// are given. Cids of different versions for the same content are grouped
+// together, under the first of them met. Paths which are alone in their
+// group have no duplicate. It fails on the first path which doesn't
+// resolve.
+func DedupByCid(ctx context.Context, r *Resolver, paths []path.Path) (map[string][]path.Path, error) {
+	groups := make(map[string][]path.Path)
+	keys := make(map[string]string)
+	for _, p := range paths {
+		nd, err := r.ResolvePath(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		c := nd.Cid()
+		key, ok := keys[contentKey(c)]
+		if !ok {
+			key = c.String()
+			keys[contentKey(c)] = key
+		}
+		groups[key] = append(groups[key], p)
+	}
+	return groups, nil
+}
@@ -0,0 +1,48 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+)
+
+func TestDedupByCid(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	root := randNode()
+	if err := root.AddNodeLink("copy", nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("child", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	grandchild := path.FromString("/dms3fs/" + nodes[0].Cid().String() + "/child/grandchild")
+	copied := path.FromString("/dms3fs/" + root.Cid().String() + "/copy")
+	child := path.FromString("/dms3fs/" + root.Cid().String() + "/child")
+
+	r := resolver.NewBasicResolver(dagService)
+	groups, err := resolver.DedupByCid(ctx, r, []path.Path{grandchild, child, copied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %v", groups)
+	}
+	if dups := groups[nodes[2].Cid().String()]; len(dups) != 2 || dups[0] != grandchild || dups[1] != copied {
+		t.Fatalf("expected %s and %s to be grouped, got %v", grandchild, copied, dups)
+	}
+	if single := groups[nodes[1].Cid().String()]; len(single) != 1 || single[0] != child {
+		t.Fatalf("expected %s alone, got %v", child, single)
+	}
+
+	if _, err := resolver.DedupByCid(ctx, r, []path.Path{child + "/missing"}); err == nil {
+		t.Fatal("expected a path which doesn't resolve to fail")
+	}
+}
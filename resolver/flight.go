@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// flight is a resolution in progress, shared by all its waiters.
+type flight struct {
+	done    chan struct{}
+	nodes   []dms3ld.Node
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup coalesces identical concurrent resolutions. Its zero value is
+// ready to use.
+type flightGroup struct {
+	mu sync.Mutex
+	m  map[string]*flight
+}
+
+// do runs fn once for all the concurrent calls made with the same key, and
+// returns its result to each of them. fn runs with its own context, which is
+// only canceled once every caller waiting for it has given up, so that one
+// caller going away doesn't abort the resolution for the others.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) ([]dms3ld.Node, error)) ([]dms3ld.Node, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flight)
+	}
+	f, ok := g.m[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.m[key] = f
+
+		go func() {
+			f.nodes, f.err = fn(fctx)
+			cancel()
+
+			g.mu.Lock()
+			if g.m[key] == f {
+				delete(g.m, key)
+			}
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.nodes, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// nobody is interested anymore, later callers start afresh.
+			f.cancel()
+			if g.m[key] == f {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package resolver_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// gatedGetter counts the fetches of every node and holds them until its
+// gate is closed.
+type gatedGetter struct {
+	dms3ld.NodeGetter
+	gate chan struct{}
+
+	mu      sync.Mutex
+	fetches map[string]int
+}
+
+func (g *gatedGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	g.mu.Lock()
+	g.fetches[c.KeyString()]++
+	g.mu.Unlock()
+
+	select {
+	case <-g.gate:
+		return g.NodeGetter.Get(ctx, c)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestCoalesceResolutions(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	r := &resolver.Resolver{
+		DAG:                 getter,
+		ResolveOnce:         resolver.ResolveSingle,
+		CoalesceResolutions: true,
+	}
+
+	// one of the callers gives up early, which must not affect the others
+	cctx, cancel := context.WithCancel(ctx)
+	canceled := make(chan error)
+	go func() {
+		_, err := r.ResolvePath(cctx, p)
+		canceled <- err
+	}()
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nd, err := r.ResolvePath(ctx, p)
+			if err == nil && !nd.Cid().Equals(nodes[2].Cid()) {
+				err = fmt.Errorf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+			}
+			errs <- err
+		}()
+	}
+
+	// give every caller the time to join the resolution in progress
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("expected the canceled caller to get context.Canceled, got %v", err)
+	}
+
+	close(getter.gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, nd := range nodes {
+		if f := getter.fetches[nd.Cid().KeyString()]; f != 1 {
+			t.Fatalf("expected %s to be fetched once, got %d fetches", nd.Cid(), f)
+		}
+	}
+}
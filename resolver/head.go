@@ -0,0 +1,53 @@
+package resolver
+
+import (
+	"context"
+
+	path "github.com/dms3-fs/go-path"
+)
+
+// HeadInfo is the metadata returned by Head.
+type HeadInfo struct {
+	// Size is the cumulative size of the DAG under the node, as returned
+	// by its Size method. For UnixFS files this includes the encoding
+	// overhead on top of the file content.
+	Size uint64
+	// ContentType is the content type ResolveContentType would return,
+	// except that a file is only sniffed when its node holds data itself.
+	ContentType string
+	// ETag is the ETag ResolveETag would return.
+	ETag string
+	// IsDir is whether the node is taken to be a directory.
+	IsDir bool
+}
+
+// Head resolves fpath and returns metadata about the node it points to, as
+// needed to answer HTTP HEAD requests. Only the nodes on the path are
+// fetched: the blocks of a file are never read.
+func (r *Resolver) Head(ctx context.Context, fpath path.Path) (HeadInfo, error) {
+	if err := fpath.IsValid(); err != nil {
+		return HeadInfo{}, err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil {
+		return HeadInfo{}, err
+	}
+
+	nd := nodes[len(nodes)-1]
+	size, err := nd.Size()
+	if err != nil {
+		return HeadInfo{}, err
+	}
+
+	ct, err := r.contentType(ctx, fpath, nd, false)
+	if err != nil {
+		return HeadInfo{}, err
+	}
+	return HeadInfo{
+		Size:        size,
+		ContentType: ct,
+		ETag:        etag(fpath, nodes),
+		IsDir:       ct == DirectoryContentType,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+	dagmock "github.com/dms3-fs/go-merkledag/test"
+)
+
+func TestHead(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	// a file made of three blocks, in a directory
+	file := randNode()
+	var blocks []dms3ld.Node
+	for i := 0; i < 3; i++ {
+		blk := merkledag.NewRawNode(make([]byte, 256+i))
+		if err := file.AddNodeLink("", blk); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, blk)
+	}
+	dir := randNode()
+	if err := dir.AddNodeLink("file.txt", file); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range append(blocks, file, dir) {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	close(getter.gate)
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = getter
+
+	p := path.FromString(path.FromCid(dir.Cid()).String() + "/file.txt")
+	info, err := r.Head(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := file.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != size || info.IsDir || info.ETag != `"`+file.Cid().String()+`"` || info.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected head %+v", info)
+	}
+	for _, blk := range blocks {
+		if getter.fetches[blk.Cid().KeyString()] != 0 {
+			t.Fatalf("expected block %s not to be fetched", blk.Cid())
+		}
+	}
+
+	info, err = r.Head(ctx, path.FromCid(dir.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir || info.ContentType != resolver.DirectoryContentType {
+		t.Fatalf("expected a directory, got %+v", info)
+	}
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	path "github.com/dms3-fs/go-path"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	dag "github.com/dms3-fs/go-merkledag"
+)
+
+// ResolveJSON resolves fpath and returns the data of the resolved node as
+// DAG-JSON, with map keys sorted: links become {"/": "<cid>"} and bytes
+// {"/": {"bytes": "<base64>"}}. Nodes whose data can't be read generically,
+// like dag-pb ones, are represented by their Data and Links, as in the
+// DAG-JSON form of dag-pb; the UnixFS metadata inside Data is not decoded.
+func (r *Resolver) ResolveJSON(ctx context.Context, fpath path.Path) ([]byte, error) {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(toDAGJSON(nodeData(nd))); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// nodeData returns the data model of nd, to be passed to toDAGJSON.
+func nodeData(nd dms3ld.Node) interface{} {
+	data := nd.RawData()
+	if pn, ok := nd.(*dag.ProtoNode); ok {
+		data = pn.Data()
+	} else if v, rest, err := nd.Resolve(nil); err == nil && len(rest) == 0 {
+		return v
+	}
+
+	links := make([]interface{}, 0, len(nd.Links()))
+	for _, l := range nd.Links() {
+		links = append(links, map[string]interface{}{
+			"Hash":  l.Cid,
+			"Name":  l.Name,
+			"Tsize": l.Size,
+		})
+	}
+	return map[string]interface{}{
+		"Data":  data,
+		"Links": links,
+	}
+}
+
+// toDAGJSON converts the links and bytes in v to their DAG-JSON form, and
+// the keys of its maps to strings, so that v can be marshalled as JSON.
+func toDAGJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *cid.Cid:
+		return map[string]interface{}{"/": v.String()}
+	case *dms3ld.Link:
+		return toDAGJSON(v.Cid)
+	case dms3ld.Link:
+		return toDAGJSON(v.Cid)
+	case []byte:
+		return map[string]interface{}{
+			"/": map[string]interface{}{"bytes": base64.RawStdEncoding.EncodeToString(v)},
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = toDAGJSON(e)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[fmt.Sprint(k)] = toDAGJSON(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = toDAGJSON(e)
+		}
+		return out
+	}
+	return v
+}
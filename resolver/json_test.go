@@ -0,0 +1,59 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+func TestResolveJSON(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	cbor := newMapNode(t, map[string]interface{}{
+		"name":  "a <b>",
+		"n":     3,
+		"child": nodes[1].Cid(),
+		"raw":   []byte("hi"),
+		"list":  []interface{}{1, nodes[2].Cid()},
+	})
+
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = extraGetter{dagService, []dms3ld.Node{cbor}}
+	out, err := r.ResolveJSON(ctx, path.FromCid(cbor.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"child":{"/":"` + nodes[1].Cid().String() + `"},` +
+		`"list":[1,{"/":"` + nodes[2].Cid().String() + `"}],` +
+		`"n":3,"name":"a <b>","raw":{"/":{"bytes":"aGk"}}}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+
+	// a directory-like dag-pb node
+	out, err = r.ResolveJSON(ctx, path.FromString(path.FromCid(nodes[0].Cid()).String()+"/child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"Data":{"/":{"bytes":"` + base64.RawStdEncoding.EncodeToString(nodes[1].Data()) + `"}},` +
+		`"Links":[{"Hash":{"/":"` + nodes[2].Cid().String() + `"},"Name":"grandchild","Tsize":` +
+		sizeString(t, nodes[2]) + `}]}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+}
+
+func sizeString(t *testing.T, nd dms3ld.Node) string {
+	size, err := nd.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strconv.FormatUint(size, 10)
+}
@@ -0,0 +1,132 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	path "github.com/dms3-fs/go-path"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ErrMaxDepth is returned when a walk would go deeper than the MaxDepth of
+// the resolver.
+var ErrMaxDepth = errors.New("maximum depth exceeded")
+
+// ListEntries resolves fpath and returns the links of the node it points to,
+// i.e. the entries of a directory. They come in the order of the node, or
+// sorted by name when SortEntries is set. The entries of a HAMT sharded
+// directory are gathered from all of its shards, under their own names.
+func (r *Resolver) ListEntries(ctx context.Context, fpath path.Path) ([]*dms3ld.Link, error) {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+	return r.dirEntries(ctx, nd)
+}
+
+// CountEntries resolves fpath and returns the number of entries of the
+// directory it points to, without fetching any of them. For a HAMT sharded
+// directory, only its inner shards are fetched.
+func (r *Resolver) CountEntries(ctx context.Context, fpath path.Path) (int, error) {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return 0, err
+	}
+	links, err := r.dirEntries(ctx, nd)
+	if err != nil {
+		return 0, err
+	}
+	return len(links), nil
+}
+
+// entries returns links, sorted when SortEntries is set.
+func (r *Resolver) entries(links []*dms3ld.Link) []*dms3ld.Link {
+	if !r.SortEntries {
+		return links
+	}
+
+	sorted := make([]*dms3ld.Link, len(links))
+	copy(sorted, links)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// ListLeaves returns the path of every leaf under fpath, in the order of
+// ListEntries. Leaves are the nodes which aren't directories: UnixFS nodes
+// of any other type and, for nodes without UnixFS data, the nodes without
+// links and the nodes with unnamed links, like multi-block files whose
+// links are their chunks. Leaves are not descended into. A node reachable
+// through several links is listed once per path. If fpath is a leaf itself,
+// it is the only path returned.
+//
+// HAMT sharded directories are descended transparently: the paths go
+// through them by entry name, as a ResolveOnce which understands UnixFS
+// resolves them, and their inner shards don't count towards the depth. The
+// walk is bounded by the MaxDepth of OptionsFor(fpath), and ErrMaxDepth is
+// returned when the subtree goes deeper.
+func (r *Resolver) ListLeaves(ctx context.Context, fpath path.Path) ([]path.Path, error) {
+	fpath, err := path.ParsePath(fpath.String())
+	if err != nil {
+		return nil, err
+	}
+
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []path.Path
+	err = r.listLeaves(ctx, nd, fpath.String(), 0, r.OptionsFor(fpath).MaxDepth, r.newProgress(-1), &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Resolver) listLeaves(ctx context.Context, nd dms3ld.Node, p string, depth, maxDepth int, prog *progress, out *[]path.Path) error {
+	prog.step()
+	if isLeaf(nd) {
+		*out = append(*out, path.FromString(p))
+		return nil
+	}
+	// an empty directory has nothing below the limit
+	if maxDepth > 0 && depth >= maxDepth && len(nd.Links()) > 0 {
+		return ErrMaxDepth
+	}
+
+	links, err := r.dirEntries(ctx, nd)
+	if err != nil {
+		return err
+	}
+
+	for _, lnk := range links {
+		child, err := r.getNode(ctx, lnk.Cid, nil)
+		if err != nil {
+			return err
+		}
+		err = r.listLeaves(ctx, child, p+"/"+lnk.Name, depth+1, maxDepth, prog, out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLeaf tells whether nd is a leaf for ListLeaves: it isn't a UnixFS
+// directory or, lacking UnixFS data, it has no links or unnamed ones which
+// are its content rather than entries.
+func isLeaf(nd dms3ld.Node) bool {
+	if d, ok := decodeUnixFS(nd); ok {
+		return d.Type != unixfsDirectory && d.Type != unixfsHAMTShard
+	}
+
+	links := nd.Links()
+	for _, lnk := range links {
+		if lnk.Name == "" {
+			return true
+		}
+	}
+	return len(links) == 0
+}
@@ -0,0 +1,365 @@
+package resolver_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+	dagmock "github.com/dms3-fs/go-merkledag/test"
+)
+
+func TestListLeaves(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	root := randNode()
+	dir := randNode()
+	fileA := merkledag.NewRawNode([]byte("a"))
+	fileB := merkledag.NewRawNode([]byte("b"))
+	fileC := randNode()
+
+	// a file made of two chunks
+	for _, chunk := range []dms3ld.Node{merkledag.NewRawNode([]byte("c1")), merkledag.NewRawNode([]byte("c2"))} {
+		if err := fileC.AddNodeLink("", chunk); err != nil {
+			t.Fatal(err)
+		}
+		if err := dagService.Add(ctx, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dir.AddNodeLink("b", fileB); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("c", fileC); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("a", fileA); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("dir", dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{root, dir, fileA, fileB, fileC} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := path.FromCid(root.Cid())
+	r := resolver.NewBasicResolver(dagService)
+	leaves, err := r.ListLeaves(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		p.String() + "/a",
+		p.String() + "/dir/b",
+		p.String() + "/dir/c",
+	}
+	if len(leaves) != len(expected) {
+		t.Fatalf("expected %d leaves, got %v", len(expected), leaves)
+	}
+	for i := range expected {
+		if leaves[i].String() != expected[i] {
+			t.Fatalf("expected leaf %d to be %s, got %s", i, expected[i], leaves[i])
+		}
+	}
+
+	leaves, err = r.ListLeaves(ctx, path.FromString(expected[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaves) != 1 || leaves[0].String() != expected[2] {
+		t.Fatalf("expected a leaf to list itself, got %v", leaves)
+	}
+
+	r.MaxDepth = 1
+	if _, err := r.ListLeaves(ctx, p); err != resolver.ErrMaxDepth {
+		t.Fatalf("expected ErrMaxDepth, got %v", err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	var calls [][2]int
+	r.Progress = func(processed, total int) {
+		calls = append(calls, [2]int{processed, total})
+	}
+	assertProgress := func(what string, total int) {
+		if len(calls) != len(nodes) {
+			t.Fatalf("%s: expected %d progress calls, got %v", what, len(nodes), calls)
+		}
+		for i, c := range calls {
+			if c != [2]int{i + 1, total} {
+				t.Fatalf("%s: expected call %d to be %v, got %v", what, i, [2]int{i + 1, total}, c)
+			}
+		}
+		calls = nil
+	}
+
+	root := path.FromCid(nodes[0].Cid())
+	if _, err := r.ListLeaves(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	assertProgress("ListLeaves", -1)
+
+	if err := r.ResolveCAR(ctx, root, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	assertProgress("ResolveCAR", -1)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResolveCARPath(ctx, p, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	assertProgress("ResolveCARPath", len(nodes))
+}
+
+// unorderedNode is a node whose links come in no particular order, like
+// the ones of a sharded directory.
+type unorderedNode struct {
+	*merkledag.ProtoNode
+	links []*dms3ld.Link
+}
+
+func (n *unorderedNode) Links() []*dms3ld.Link {
+	return n.links
+}
+
+func TestSortEntries(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	files := map[string]*merkledag.RawNode{}
+	dir := &unorderedNode{ProtoNode: randNode()}
+	for _, name := range []string{"z", "a", "m"} {
+		files[name] = merkledag.NewRawNode([]byte(name))
+		if err := dagService.Add(ctx, files[name]); err != nil {
+			t.Fatal(err)
+		}
+		dir.links = append(dir.links, &dms3ld.Link{Name: name, Cid: files[name].Cid()})
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = extraGetter{dagService, []dms3ld.Node{dir}}
+	p := path.FromCid(dir.Cid())
+
+	entries, err := r.ListEntries(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Name != "z" {
+		t.Fatalf("expected the entries in node order, got %v", entries)
+	}
+
+	r.SortEntries = true
+	entries, err = r.ListEntries(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "m", "z"} {
+		if entries[i].Name != name || !entries[i].Cid.Equals(files[name].Cid()) {
+			t.Fatalf("expected entry %d to be %s, got %s", i, name, entries[i].Name)
+		}
+	}
+	if dir.Links()[0].Name != "z" {
+		t.Fatal("sorting the entries changed the node")
+	}
+
+	leaves, err := r.ListLeaves(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "m", "z"} {
+		if leaves[i].String() != p.String()+"/"+name {
+			t.Fatalf("expected leaf %d to be %s, got %s", i, name, leaves[i])
+		}
+	}
+}
+
+func TestCountEntries(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	close(getter.gate)
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = getter
+
+	dir := randNode()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := dir.AddNodeLink(name, nodes[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dagService.Add(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := r.CountEntries(ctx, path.FromCid(dir.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+	if f := getter.fetches[nodes[2].Cid().KeyString()]; f != 0 {
+		t.Fatalf("expected the entries not to be fetched, got %d fetches", f)
+	}
+
+	shard, files := newShardedFixture(t, dagService)
+	n, err = r.CountEntries(ctx, path.FromCid(shard.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(files) {
+		t.Fatalf("expected %d entries, got %d", len(files), n)
+	}
+	for name, nd := range files {
+		if f := getter.fetches[nd.Cid().KeyString()]; f != 0 {
+			t.Fatalf("expected entry %s not to be fetched, got %d fetches", name, f)
+		}
+	}
+}
+
+// unixfsNode returns a dag-pb node holding UnixFS data of the given type,
+// encoded like the unixfs package does. data and fanout are left out when
+// zero.
+func unixfsNode(typ uint64, data []byte, fanout uint64) *merkledag.ProtoNode {
+	b := appendUvarint([]byte{1 << 3}, typ)
+	if data != nil {
+		b = appendUvarint(append(b, 2<<3|2), uint64(len(data)))
+		b = append(b, data...)
+	}
+	if fanout != 0 {
+		b = appendUvarint(append(b, 6<<3), fanout)
+	}
+
+	nd := new(merkledag.ProtoNode)
+	nd.SetData(b)
+	return nd
+}
+
+// newShardedFixture builds a HAMT sharded directory holding the raw files
+// z, a, m and b, the last two in an inner shard, along with an empty
+// directory named empty, and returns it with its files.
+func newShardedFixture(t *testing.T, dagService dms3ld.DAGService) (*merkledag.ProtoNode, map[string]dms3ld.Node) {
+	ctx := context.Background()
+	files := map[string]dms3ld.Node{}
+	for _, name := range []string{"z", "a", "m", "b"} {
+		files[name] = merkledag.NewRawNode([]byte(name))
+	}
+	files["empty"] = unixfsNode(1, nil, 0)
+
+	inner := unixfsNode(5, nil, 256)
+	add := func(shard *merkledag.ProtoNode, name string, nd dms3ld.Node) {
+		if err := shard.AddNodeLink(name, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := dagService.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(inner, "0Bm", files["m"])
+	add(inner, "C2b", files["b"])
+
+	shard := unixfsNode(5, nil, 256)
+	add(shard, "00z", files["z"])
+	add(shard, "1Fa", files["a"])
+	add(shard, "2E", inner)
+	add(shard, "7Aempty", files["empty"])
+	if err := dagService.Add(ctx, shard); err != nil {
+		t.Fatal(err)
+	}
+	return shard, files
+}
+
+func TestListLeavesSharded(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+	shard, _ := newShardedFixture(t, dagService)
+
+	root := randNode()
+	if err := root.AddNodeLink("dir", shard); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	r.SortEntries = true
+	p := path.FromCid(root.Cid())
+	leaves, err := r.ListLeaves(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "m", "z"}
+	if len(leaves) != len(expected) {
+		t.Fatalf("expected %d leaves, got %v", len(expected), leaves)
+	}
+	for i, name := range expected {
+		if leaves[i].String() != p.String()+"/dir/"+name {
+			t.Fatalf("expected leaf %d to be %s, got %s", i, name, leaves[i])
+		}
+	}
+
+	// the shards don't count towards the depth
+	r.MaxDepth = 2
+	if _, err := r.ListLeaves(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := unixfsNode(5, nil, 256)
+	if err := bad.AddNodeLink("a", shard); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, bad); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ListLeaves(ctx, path.FromCid(bad.Cid())); err != resolver.ErrBadShard {
+		t.Fatalf("expected ErrBadShard, got %v", err)
+	}
+}
+
+func TestSortEntriesSharded(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+	shard, files := newShardedFixture(t, dagService)
+
+	// in shard order, m comes before b
+	r := resolver.NewBasicResolver(dagService)
+	r.SortEntries = true
+	entries, err := r.ListEntries(ctx, path.FromCid(shard.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "empty", "m", "z"}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %v", len(expected), entries)
+	}
+	for i, name := range expected {
+		if entries[i].Name != name || !entries[i].Cid.Equals(files[name].Cid()) {
+			t.Fatalf("expected entry %d to be %s, got %s", i, name, entries[i].Name)
+		}
+	}
+}
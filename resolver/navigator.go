@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+
+	path "github.com/dms3-fs/go-path"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ErrAtRoot is returned when trying to move a Navigator up from the node it
+// started at.
+var ErrAtRoot = errors.New("navigator is at its root")
+
+// Navigator moves through a DAG one link at a time, starting from a resolved
+// path. The nodes on the way are kept, so going back up never fetches
+// anything and going down only fetches the entered node.
+type Navigator struct {
+	r     *Resolver
+	root  path.Path
+	nodes []dms3ld.Node
+	names []string
+}
+
+// Navigator resolves root and returns a Navigator positioned on it.
+func (r *Resolver) Navigator(ctx context.Context, root path.Path) (*Navigator, error) {
+	root, err := path.ParsePath(root.String())
+	if err != nil {
+		return nil, err
+	}
+
+	nd, err := r.ResolvePath(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Navigator{
+		r:     r,
+		root:  root,
+		nodes: []dms3ld.Node{nd},
+	}, nil
+}
+
+// Enter moves the navigator down the link with the given name. The link is
+// resolved like Resolve would resolve it as the next segment of Path, with
+// the options of the resolver for the root of the navigator.
+func (n *Navigator) Enter(ctx context.Context, name string) error {
+	nodes, err := n.r.resolveLinks(ctx, n.Node(), []string{name}, n.r.OptionsFor(n.root), nil)
+	if err != nil {
+		return err
+	}
+
+	n.nodes = append(n.nodes, nodes[len(nodes)-1])
+	n.names = append(n.names, name)
+	return nil
+}
+
+// Up moves the navigator back to the parent of the current node. It returns
+// ErrAtRoot when the navigator is on the node it started at.
+func (n *Navigator) Up() error {
+	if len(n.names) == 0 {
+		return ErrAtRoot
+	}
+	n.nodes = n.nodes[:len(n.nodes)-1]
+	n.names = n.names[:len(n.names)-1]
+	return nil
+}
+
+// Node returns the node the navigator is on.
+func (n *Navigator) Node() dms3ld.Node {
+	return n.nodes[len(n.nodes)-1]
+}
+
+// Path returns the path of the node the navigator is on.
+func (n *Navigator) Path() path.Path {
+	if len(n.names) == 0 {
+		return n.root
+	}
+	return path.FromString(n.root.String() + "/" + path.Join(n.names))
+}
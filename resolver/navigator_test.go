@@ -0,0 +1,98 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+func TestNavigator(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	root := path.FromCid(nodes[0].Cid())
+	nav, err := r.Navigator(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertAt := func(i int, p string) {
+		t.Helper()
+		if !nav.Node().Cid().Equals(nodes[i].Cid()) {
+			t.Fatalf("expected navigator to be at %s, got %s", nodes[i].Cid(), nav.Node().Cid())
+		}
+		if nav.Path().String() != p {
+			t.Fatalf("expected navigator path %s, got %s", p, nav.Path())
+		}
+	}
+
+	assertAt(0, root.String())
+
+	if err := nav.Enter(ctx, "child"); err != nil {
+		t.Fatal(err)
+	}
+	assertAt(1, root.String()+"/child")
+
+	if err := nav.Enter(ctx, "grandchild"); err != nil {
+		t.Fatal(err)
+	}
+	assertAt(2, root.String()+"/child/grandchild")
+
+	if err := nav.Enter(ctx, "missing"); err == nil {
+		t.Fatal("expected entering a missing link to fail")
+	}
+	assertAt(2, root.String()+"/child/grandchild")
+
+	if err := nav.Up(); err != nil {
+		t.Fatal(err)
+	}
+	assertAt(1, root.String()+"/child")
+
+	if err := nav.Up(); err != nil {
+		t.Fatal(err)
+	}
+	assertAt(0, root.String())
+
+	if err := nav.Up(); err != resolver.ErrAtRoot {
+		t.Fatalf("expected ErrAtRoot going up from the root, got %v", err)
+	}
+}
+
+func TestNavigatorOptions(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+	r.OnLinkNotFound = func(ctx context.Context, nd dms3ld.Node, name string) (*dms3ld.Link, error) {
+		if name != "alias" {
+			return nil, nil
+		}
+		return &dms3ld.Link{Name: name, Cid: nodes[2].Cid()}, nil
+	}
+	r.CidSegmentsAreJumps = true
+	r.AllowedRoots = cid.NewSet()
+	r.AllowedRoots.Add(nodes[0].Cid())
+
+	nav, err := r.Navigator(ctx, path.FromCid(nodes[0].Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entering goes through the same hooks and checks as Resolve
+	if err := nav.Enter(ctx, "alias"); err != nil {
+		t.Fatal(err)
+	}
+	if !nav.Node().Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected navigator to be at %s, got %s", nodes[2].Cid(), nav.Node().Cid())
+	}
+
+	err = nav.Enter(ctx, nodes[1].Cid().String())
+	if e, ok := err.(resolver.ErrRootNotAllowed); !ok || !e.Cid.Equals(nodes[1].Cid()) {
+		t.Fatalf("expected ErrRootNotAllowed for %s, got %v", nodes[1].Cid(), err)
+	}
+}
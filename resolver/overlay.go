@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"context"
+
+	path "github.com/dms3-fs/go-path"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// resolveOverlay resolves fpath from the node of the Overlay of r matching
+// the deepest prefix of fpath, the nodes above it being resolved as usual.
+// An overlaid root is subject to AllowedRoots like any other. ok is false
+// when no prefix of fpath is overlaid.
+func (r *Resolver) resolveOverlay(ctx context.Context, fpath path.Path, opts ResolverOptions, st *resolveStats) (nodes []dms3ld.Node, ok bool, err error) {
+	p, err := path.ParsePath(fpath.String())
+	if err != nil {
+		// left for the regular resolution to report
+		return nil, false, nil
+	}
+
+	segs := p.Segments()
+	rootLen := len(segs) - len(p.TrimProtocol()) + 1
+	for i := len(segs); i >= rootLen; i-- {
+		nd, found := r.Overlay["/"+path.Join(segs[:i])]
+		if !found {
+			continue
+		}
+
+		if i > rootLen {
+			nodes, err = r.resolvePathComponents(ctx, path.FromString("/"+path.Join(segs[:i-1])), st)
+			if err != nil {
+				return nodes, true, err
+			}
+		} else {
+			// the overlaid root still has to be allowed; roots which
+			// aren't cids are checked by the cid of their overlay node
+			c, _, err := r.splitRoot(p)
+			if err != nil {
+				c = nd.Cid()
+			}
+			if err := r.checkRoot(c); err != nil {
+				return nil, true, err
+			}
+		}
+		rest, err := r.resolveLinks(ctx, nd, segs[i:], opts, st)
+		return append(nodes, rest...), true, err
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,85 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+)
+
+func TestOverlay(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	// patched is never added to the DAG
+	patched := merkledag.NodeWithData([]byte("patched"))
+	if err := patched.AddNodeLink("grandchild", nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	root := "/dms3fs/" + nodes[0].Cid().String()
+	r := resolver.NewBasicResolver(dagService)
+	r.Overlay = map[string]dms3ld.Node{root + "/child": patched}
+
+	nd, err := r.ResolvePath(ctx, path.FromString(root+"/child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd != patched {
+		t.Fatalf("expected the overlay node, got %s", nd.Cid())
+	}
+
+	components, err := r.ResolvePathComponents(ctx, path.FromString(nodes[0].Cid().String()+"/child/grandchild"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 3 || components[0].Cid().KeyString() != nodes[0].Cid().KeyString() ||
+		components[1] != patched || components[2].Cid().KeyString() != nodes[2].Cid().KeyString() {
+		t.Fatalf("expected resolution to go through the overlay node, got %v", components)
+	}
+
+	// paths not going through the overlay are left alone
+	r.Overlay = map[string]dms3ld.Node{root + "/other": patched}
+	nd, err = r.ResolvePath(ctx, path.FromString(root+"/child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid().KeyString() != nodes[1].Cid().KeyString() {
+		t.Fatalf("expected %s, got %s", nodes[1].Cid(), nd.Cid())
+	}
+}
+
+func TestOverlayAllowedRoots(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	patched := merkledag.NodeWithData([]byte("patched"))
+	if err := patched.AddNodeLink("child", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	root := "/dms3fs/" + nodes[0].Cid().String()
+	r := resolver.NewBasicResolver(dagService)
+	r.Overlay = map[string]dms3ld.Node{root: patched}
+	r.AllowedRoots = cid.NewSet()
+	r.AllowedRoots.Add(nodes[1].Cid())
+
+	_, err := r.ResolvePath(ctx, path.FromString(root+"/child"))
+	if e, ok := err.(resolver.ErrRootNotAllowed); !ok || !e.Cid.Equals(nodes[0].Cid()) {
+		t.Fatalf("expected ErrRootNotAllowed for %s, got %v", nodes[0].Cid(), err)
+	}
+
+	r.AllowedRoots.Add(nodes[0].Cid())
+	nd, err := r.ResolvePath(ctx, path.FromString(root+"/child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid().KeyString() != nodes[1].Cid().KeyString() {
+		t.Fatalf("expected %s, got %s", nodes[1].Cid(), nd.Cid())
+	}
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+
+	path "github.com/dms3-fs/go-path"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ErrNotFound is returned by PathToCid when the target can't be reached
+// from the root.
+var ErrNotFound = errors.New("target not reachable from root")
+
+// PathToCid searches the DAG under root for target, breadth first, and
+// returns the path of named links leading to it. The path returned is one
+// of the shortest. Unnamed links, like the chunks of a file, aren't
+// followed, since no path goes through them. The search goes at most
+// MaxDepth links deep, as given by OptionsFor, if set, and fails with
+// ErrNotFound when target isn't found. Cids are compared by content, so a
+// target found under another cid version matches.
+func (r *Resolver) PathToCid(ctx context.Context, root *cid.Cid, target *cid.Cid) (path.Path, error) {
+	if err := r.checkRoot(root); err != nil {
+		return "", err
+	}
+	if sameContent(root, target) {
+		return path.FromCid(root), nil
+	}
+
+	type step struct {
+		nd    dms3ld.Node
+		names []string
+	}
+
+	nd, err := r.getNode(ctx, root, nil)
+	if err != nil {
+		return "", err
+	}
+
+	maxDepth := r.OptionsFor(path.FromCid(root)).MaxDepth
+	seen := map[string]bool{contentKey(root): true}
+	level := []step{{nd: nd}}
+	for depth := 1; len(level) > 0; depth++ {
+		// the links of the last level are checked, but not fetched
+		last := maxDepth > 0 && depth >= maxDepth
+		var next []step
+		for _, s := range level {
+			for _, lnk := range s.nd.Links() {
+				// unnamed links, like the chunks of a file, can't be
+				// part of a path
+				if lnk.Name == "" {
+					continue
+				}
+				names := append(s.names[:len(s.names):len(s.names)], lnk.Name)
+				if sameContent(lnk.Cid, target) {
+					return path.JoinCidAndRest(root, names), nil
+				}
+
+				k := contentKey(lnk.Cid)
+				if last || seen[k] {
+					continue
+				}
+				seen[k] = true
+
+				child, err := r.getNode(ctx, lnk.Cid, nil)
+				if err != nil {
+					return "", err
+				}
+				next = append(next, step{nd: child, names: names})
+			}
+		}
+		level = next
+	}
+	return "", ErrNotFound
+}
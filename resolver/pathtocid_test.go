@@ -0,0 +1,89 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+)
+
+func TestPathToCid(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+	root := nodes[0].Cid()
+
+	p, err := r.PathToCid(ctx, root, nodes[2].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := path.FromSegments("/dms3fs/", root.String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != expected {
+		t.Fatalf("expected %s, got %s", expected, p)
+	}
+
+	if p, err := r.PathToCid(ctx, root, root); err != nil || p != path.FromCid(root) {
+		t.Fatalf("expected the root to be found at its own path, got %s and %v", p, err)
+	}
+
+	if _, err := r.PathToCid(ctx, root, randNode().Cid()); err != resolver.ErrNotFound {
+		t.Fatalf("expected ErrNotFound for an unrelated cid, got %v", err)
+	}
+
+	// the chunks of a file are not addressable by path
+	chunk1 := merkledag.NewRawNode([]byte("chunk1"))
+	chunk2 := merkledag.NewRawNode([]byte("chunk2"))
+	file := randNode()
+	dir := randNode()
+	for _, c := range []dms3ld.Node{chunk1, chunk2} {
+		if err := file.AddNodeLink("", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dir.AddNodeLink("f", file); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{chunk1, chunk2, file, dir} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, err := r.PathToCid(ctx, dir.Cid(), chunk2.Cid()); err != resolver.ErrNotFound {
+		t.Fatalf("expected ErrNotFound through an unnamed link, got %s and %v", p, err)
+	}
+	if _, err := r.PathToCid(ctx, dir.Cid(), file.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	close(getter.gate)
+	r.DAG = getter
+	r.MaxDepth = 1
+	if _, err := r.PathToCid(ctx, root, nodes[2].Cid()); err != resolver.ErrNotFound {
+		t.Fatalf("expected ErrNotFound beyond MaxDepth, got %v", err)
+	}
+	if f := getter.fetches[nodes[1].Cid().KeyString()]; f != 0 {
+		t.Fatalf("expected nodes beyond MaxDepth not to be fetched, got %d fetches", f)
+	}
+	if _, err := r.PathToCid(ctx, root, nodes[1].Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the depth comes from the options for the root
+	r.MaxDepth = 0
+	r.ProtocolConfig = map[string]resolver.ResolverOptions{"dms3fs": {MaxDepth: 1}}
+	if _, err := r.PathToCid(ctx, root, nodes[2].Cid()); err != resolver.ErrNotFound {
+		t.Fatalf("expected ErrNotFound beyond the dms3fs MaxDepth, got %v", err)
+	}
+}
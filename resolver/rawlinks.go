@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	path "github.com/dms3-fs/go-path"
+
+	cid "github.com/dms3-fs/go-cid"
+)
+
+// errMalformedProtobuf is returned when the data of a dag-pb node can't be
+// parsed.
+var errMalformedProtobuf = errors.New("malformed dag-pb node")
+
+// ResolveRawLinks resolves fpath and returns the links of the node it
+// points to exactly as they are serialized in it, i.e. the PBLink messages
+// of a dag-pb node, in the order they are stored. Raw nodes have no links.
+// Nodes of other codecs aren't supported.
+func (r *Resolver) ResolveRawLinks(ctx context.Context, fpath path.Path) ([][]byte, error) {
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch codec := nd.Cid().Type(); codec {
+	case cid.Raw:
+		return nil, nil
+	case cid.DagProtobuf:
+	default:
+		return nil, fmt.Errorf("raw links of codec 0x%x nodes are not supported", codec)
+	}
+
+	var links [][]byte
+	data := nd.RawData()
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errMalformedProtobuf
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errMalformedProtobuf
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return nil, errMalformedProtobuf
+			}
+			data = data[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return nil, errMalformedProtobuf
+			}
+			if key>>3 == 2 {
+				links = append(links, data[n:n+int(l)])
+			}
+			data = data[n+int(l):]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return nil, errMalformedProtobuf
+			}
+			data = data[4:]
+		default:
+			return nil, errMalformedProtobuf
+		}
+	}
+	return links, nil
+}
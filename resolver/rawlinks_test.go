@@ -0,0 +1,83 @@
+package resolver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	merkledag "github.com/dms3-fs/go-merkledag"
+)
+
+// encodePBLink encodes a link as a PBLink message.
+func encodePBLink(lnk *dms3ld.Link) []byte {
+	var buf []byte
+	field := func(key uint64, b []byte) {
+		buf = append(buf, byte(key))
+		buf = appendUvarint(buf, uint64(len(b)))
+		buf = append(buf, b...)
+	}
+	field(1<<3|2, lnk.Cid.Bytes())
+	field(2<<3|2, []byte(lnk.Name))
+	buf = append(buf, 3<<3)
+	return appendUvarint(buf, lnk.Size)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func TestResolveRawLinks(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	extra := merkledag.NewRawNode([]byte("extra"))
+	dir := randNode()
+	if err := dir.AddNodeLink("b", nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddNodeLink("a", extra); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{extra, dir} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	raw, err := r.ResolveRawLinks(ctx, path.FromCid(dir.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := dir.Links()
+	if len(raw) != len(links) {
+		t.Fatalf("expected %d raw links, got %d", len(links), len(raw))
+	}
+	for i, lnk := range links {
+		if !bytes.Equal(raw[i], encodePBLink(lnk)) {
+			t.Fatalf("raw link %d doesn't match %s: %x", i, lnk.Name, raw[i])
+		}
+		if !bytes.Contains(dir.RawData(), raw[i]) {
+			t.Fatalf("raw link %d isn't part of the node encoding", i)
+		}
+	}
+
+	p, err := path.FromSegments("/dms3fs/", dir.Cid().String(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err = r.ResolveRawLinks(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != nil {
+		t.Fatalf("expected a raw node to have no links, got %x", raw)
+	}
+}
@@ -34,9 +34,106 @@ func (e ErrNoLink) Error() string {
 	return fmt.Sprintf("no link named %q under %s", e.Name, e.Node.String())
 }
 
+// ErrUnknownRoot is returned when a dms3ns path names a root missing from
+// the StaticRoots of the resolver.
+type ErrUnknownRoot struct {
+	Name string
+}
+
+// Error implements the Error interface for ErrUnknownRoot.
+func (e ErrUnknownRoot) Error() string {
+	return fmt.Sprintf("no static root named %q", e.Name)
+}
+
+// ErrByteBudgetExceeded is returned when a resolution fetches more than the
+// MaxTotalBytes of the resolver.
+var ErrByteBudgetExceeded = errors.New("resolution exceeded its byte budget")
+
+// ErrRootNotAllowed is returned when resolving a path whose root isn't in
+// the AllowedRoots of the resolver.
+type ErrRootNotAllowed struct {
+	Cid *cid.Cid
+}
+
+// Error implements the Error interface for ErrRootNotAllowed.
+func (e ErrRootNotAllowed) Error() string {
+	return fmt.Sprintf("root %s is not allowed", e.Cid)
+}
+
+// ErrNodeTooLarge is returned when a node bigger than the MaxNodeSize of the
+// resolver is fetched.
+type ErrNodeTooLarge struct {
+	Cid  *cid.Cid
+	Size int
+}
+
+// Error implements the Error interface for ErrNodeTooLarge.
+func (e ErrNodeTooLarge) Error() string {
+	return fmt.Sprintf("node %s is too large: %d bytes", e.Cid, e.Size)
+}
+
+// HopTiming records how long a single hop of a resolution took.
+type HopTiming struct {
+	// Name is the part of the path consumed by this hop.
+	Name string
+	// Cid is the cid of the node the hop arrived at.
+	Cid *cid.Cid
+	// Duration covers both the ResolveOnce call and fetching the node.
+	Duration time.Duration
+}
+
+// Event is a structured event recorded while resolving a path. These are
+// the events otherwise only sent to the event log.
+type Event struct {
+	Name     string
+	Time     time.Time
+	Metadata map[string]interface{}
+}
+
+// resolveStats collects optional information about a single resolution.
+type resolveStats struct {
+	timings []HopTiming
+	events  []Event
+	stale   bool
+	fetched int64
+	// remaining holds the names left to resolve after the last hop.
+	remaining []string
+}
+
+// record adds an event to the ones collected in st, if any.
+func (st *resolveStats) record(name string, m logging.LoggableMap) {
+	if st == nil {
+		return
+	}
+	st.events = append(st.events, Event{Name: name, Time: time.Now(), Metadata: m})
+}
+
+// appendError adds err to the event in progress and to the events collected
+// in st, if any.
+func appendError(evt *logging.EventInProgress, st *resolveStats, err error) {
+	m := logging.LoggableMap{"error": err.Error()}
+	evt.Append(m)
+	st.record("error", m)
+}
+
 // ResolveOnce resolves path through a single node
 type ResolveOnce func(ctx context.Context, ds dms3ld.NodeGetter, nd dms3ld.Node, names []string) (*dms3ld.Link, []string, error)
 
+// NameRecordMeta describes the record a dms3ns name was resolved through, for
+// callers deciding how long to cache a resolution.
+type NameRecordMeta struct {
+	// Sequence is the sequence number of the record.
+	Sequence uint64
+	// ValidUntil is the time after which the record expires.
+	ValidUntil time.Time
+	// TTL is how long the record may be cached, if set.
+	TTL time.Duration
+}
+
+// ResolveName resolves a dms3ns name, returning the path it points to along
+// with information about the record it was found in.
+type ResolveName func(ctx context.Context, name string) (path.Path, NameRecordMeta, error)
+
 // Resolver provides path resolution to DMS3FS
 // It has a pointer to a DAGService, which is uses to resolve nodes.
 // TODO: now that this is more modular, try to unify this code with the
@@ -45,6 +142,135 @@ type Resolver struct {
 	DAG dms3ld.NodeGetter
 
 	ResolveOnce ResolveOnce
+
+	// ServeStaleOnError makes the resolver fall back to the nodes in Cache
+	// when a node cannot be fetched from DAG, e.g. when fetches time out
+	// during a network partition, but not when the resolution is canceled.
+	// ResolveStale tells whether that happened.
+	ServeStaleOnError bool
+	Cache             dms3ld.NodeGetter
+
+	// CoalesceResolutions makes concurrent calls to ResolvePath and
+	// ResolvePathComponents for the same path share a single resolution.
+	// The returned nodes are then shared between the callers too.
+	CoalesceResolutions bool
+	flights             flightGroup
+
+	// FallbackToRawIPLD makes every hop ResolveOnce fails on be retried with
+	// ResolveSingle, which follows the links of the node as generic IPLD.
+	// This lets resolvers specialised for UnixFS go through the plain IPLD
+	// nodes of mixed DAGs.
+	FallbackToRawIPLD bool
+
+	// ResolveName is used by ResolveNameDetailed to resolve dms3ns names.
+	ResolveName ResolveName
+
+	// StaticRoots, when not nil, resolves /dms3ns/<name>/... paths against
+	// the given cids instead of a name system. Names missing from it fail
+	// with ErrUnknownRoot, without any network call.
+	StaticRoots map[string]*cid.Cid
+
+	// AllowedRoots, when not nil, restricts resolution to the paths rooted
+	// at one of its cids, under either cid version. Other paths fail with
+	// ErrRootNotAllowed before anything is fetched.
+	AllowedRoots *cid.Set
+
+	// CidSegmentsAreJumps makes path components which are valid cids jump
+	// straight to the node with that cid, instead of being resolved as link
+	// names in the current node. Jumps are checked against AllowedRoots like
+	// the root of the path.
+	CidSegmentsAreJumps bool
+
+	// SortEntries makes ListEntries and ListLeaves sort the links of every
+	// node by name, for listings which don't depend on the order of the
+	// links in the nodes. The entries of sharded directories are sorted
+	// across all of their shards.
+	SortEntries bool
+
+	// AutoFollowSingleLink makes resolution go through wrapper nodes: when
+	// a name isn't found in a node which has a single link, that link is
+	// followed and the name looked up again in the linked node. A node is
+	// only followed this way once per resolution.
+	AutoFollowSingleLink bool
+
+	// OnLinkNotFound, when set, is called when the first of the names left
+	// to resolve isn't a link of nd, e.g. to look it up in a remote index.
+	// Resolution resumes at the link it returns, if any. When it returns
+	// neither a link nor an error, resolution fails with ErrNoLink.
+	OnLinkNotFound func(ctx context.Context, nd dms3ld.Node, name string) (*dms3ld.Link, error)
+
+	// MaxNodeSize, when positive, makes fetching a node whose raw data is
+	// larger than MaxNodeSize bytes fail with ErrNodeTooLarge.
+	MaxNodeSize int
+
+	// MaxTotalBytes, when positive, bounds the total size of the raw data of
+	// the nodes a single resolution may fetch. Resolutions going over fail
+	// with ErrByteBudgetExceeded.
+	MaxTotalBytes int64
+
+	// MaxDepth bounds how many links deep ListLeaves walks below the path
+	// it is given, and PathToCid below its root. A MaxDepth of 0 means no
+	// limit.
+	MaxDepth int
+
+	// TotalTimeout, when set, bounds the time a whole resolution may take.
+	// Each hop then gets an equal share of the time left for the hops
+	// which remain, instead of the default fixed per-hop timeout.
+	TotalTimeout time.Duration
+
+	// Overlay shadows parts of the DAG: resolving a path which goes through
+	// one of its keys, paths as returned by path.ParsePath, continues from
+	// the node it maps to instead of fetching the node at that path. It
+	// applies to the resolutions going through ResolvePathComponents, like
+	// ResolvePath.
+	Overlay map[string]dms3ld.Node
+
+	// Progress, when set, is called by ListLeaves, ResolveCAR and
+	// ResolveCARPath each time they have processed a node, with the number
+	// of nodes processed so far and the total number of nodes to process,
+	// or -1 when it isn't known in advance.
+	Progress func(processed, total int)
+
+	// ProtocolConfig overrides the options above for the paths of a given
+	// protocol, e.g. "dms3ns". See OptionsFor.
+	ProtocolConfig map[string]ResolverOptions
+}
+
+// ResolverOptions are the options of a Resolver which can be set per
+// protocol in its ProtocolConfig. Zero fields keep the value set on the
+// Resolver.
+type ResolverOptions struct {
+	// Timeout takes the place of TotalTimeout.
+	Timeout time.Duration
+	// MaxDepth takes the place of MaxDepth.
+	MaxDepth int
+	// ResolveOnce takes the place of ResolveOnce.
+	ResolveOnce ResolveOnce
+}
+
+// OptionsFor returns the options used to resolve fpath: the ones of the
+// Resolver, overridden by the ProtocolConfig entry for the protocol of fpath.
+func (r *Resolver) OptionsFor(fpath path.Path) ResolverOptions {
+	opts := ResolverOptions{
+		Timeout:     r.TotalTimeout,
+		MaxDepth:    r.MaxDepth,
+		ResolveOnce: r.ResolveOnce,
+	}
+
+	pc, ok := r.ProtocolConfig[path.Protocol(fpath.String())]
+	if !ok {
+		return opts
+	}
+	if pc.Timeout > 0 {
+		opts.Timeout = pc.Timeout
+	}
+	if pc.MaxDepth > 0 {
+		opts.MaxDepth = pc.MaxDepth
+	}
+	if pc.ResolveOnce != nil {
+		opts.ResolveOnce = pc.ResolveOnce
+	}
+	return opts
 }
 
 // NewBasicResolver constructs a new basic resolver.
@@ -58,7 +284,7 @@ func NewBasicResolver(ds dms3ld.DAGService) *Resolver {
 // ResolveToLastNode walks the given path and returns the cid of the last node
 // referenced by the path
 func (r *Resolver) ResolveToLastNode(ctx context.Context, fpath path.Path) (*cid.Cid, []string, error) {
-	c, p, err := path.SplitAbsPath(fpath)
+	c, p, err := r.splitPath(fpath)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -67,13 +293,22 @@ func (r *Resolver) ResolveToLastNode(ctx context.Context, fpath path.Path) (*cid
 		return c, nil, nil
 	}
 
-	nd, err := r.DAG.Get(ctx, c)
+	var st *resolveStats
+	if r.MaxTotalBytes > 0 {
+		st = new(resolveStats)
+	}
+
+	nd, err := r.getNode(ctx, c, st)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	opts := r.OptionsFor(fpath)
 	for len(p) > 0 {
-		lnk, rest, err := r.ResolveOnce(ctx, r.DAG, nd, p)
+		lnk, rest, err := r.resolveOnce(ctx, opts, nd, p)
+		if _, ok := err.(ErrRootNotAllowed); ok {
+			return nil, nil, err
+		}
 
 		// Note: have to drop the error here as `ResolveOnce` doesn't handle 'leaf'
 		// paths (so e.g. for `echo '{"foo":123}' | dms3fs dag put` we wouldn't be
@@ -86,7 +321,7 @@ func (r *Resolver) ResolveToLastNode(ctx context.Context, fpath path.Path) (*cid
 			return nil, nil, err
 		}
 
-		next, err := lnk.GetNode(ctx, r.DAG)
+		next, err := r.getNode(ctx, lnk.Cid, st)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -115,6 +350,76 @@ func (r *Resolver) ResolveToLastNode(ctx context.Context, fpath path.Path) (*cid
 	}
 }
 
+// SplitAtLeaf resolves fpath like ResolveToLastNode and splits it where
+// links end: linkPath is the prefix of fpath made of links, leading to the
+// last node, and dataPath the rest of fpath, which navigates the data
+// inside that node, e.g. the fields of a DAG-CBOR node.
+func (r *Resolver) SplitAtLeaf(ctx context.Context, fpath path.Path) (linkPath path.Path, dataPath []string, err error) {
+	fpath, err = path.ParsePath(fpath.String())
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, rest, err := r.ResolveToLastNode(ctx, fpath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	segs := fpath.Segments()
+	return path.FromString("/" + path.Join(segs[:len(segs)-len(rest)])), rest, nil
+}
+
+// HasChanged resolves fpath like ResolveToLastNode and returns whether the
+// cid of the last node differs from knownCid, along with that cid. Paths
+// rooted at a cid never change; dms3ns paths do when their name is
+// repointed. A nil knownCid always counts as changed, and a knownCid of
+// another version than the resolved one only counts when its content
+// differs.
+func (r *Resolver) HasChanged(ctx context.Context, fpath path.Path, knownCid *cid.Cid) (bool, *cid.Cid, error) {
+	c, _, err := r.ResolveToLastNode(ctx, fpath)
+	if err != nil {
+		return false, nil, err
+	}
+	return knownCid == nil || !sameContent(c, knownCid), c, nil
+}
+
+// ResolveToLastCidFast walks the given path and returns the cid of the last
+// node referenced by it. Only the links of the traversed nodes are looked at,
+// through dms3ld.GetLinks, so node bodies don't need to be fetched when the
+// NodeGetter implements dms3ld.LinkGetter, and the last node is never
+// fetched at all.
+//
+// Unlike ResolveToLastNode every path component is resolved as a link name
+// without using ResolveOnce, so it can't resolve through sharded directories
+// nor into the data of a node.
+func (r *Resolver) ResolveToLastCidFast(ctx context.Context, fpath path.Path) (*cid.Cid, error) {
+	c, p, err := r.splitPath(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range p {
+		links, err := dms3ld.GetLinks(ctx, r.DAG, c)
+		if err != nil {
+			return nil, err
+		}
+
+		var next *cid.Cid
+		for _, lnk := range links {
+			if lnk.Name == name {
+				next = lnk.Cid
+				break
+			}
+		}
+		if next == nil {
+			return nil, ErrNoLink{Name: name, Node: c}
+		}
+		c = next
+	}
+
+	return c, nil
+}
+
 // ResolvePath fetches the node for given path. It returns the last item
 // returned by ResolvePathComponents.
 func (r *Resolver) ResolvePath(ctx context.Context, fpath path.Path) (dms3ld.Node, error) {
@@ -130,33 +435,411 @@ func (r *Resolver) ResolvePath(ctx context.Context, fpath path.Path) (dms3ld.Nod
 	return nodes[len(nodes)-1], err
 }
 
+// ResolveWithParent fetches the node for given path along with the node
+// linking to it and the name of that link. This is what is needed to modify
+// the parent, e.g. to remove the entry. If the path refers to a root node
+// parent is nil and name is empty.
+func (r *Resolver) ResolveWithParent(ctx context.Context, fpath path.Path) (parent dms3ld.Node, target dms3ld.Node, name string, err error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, "", err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil || nodes == nil {
+		return nil, nil, "", err
+	}
+
+	target = nodes[len(nodes)-1]
+	if len(nodes) == 1 {
+		return nil, target, "", nil
+	}
+
+	_, parts, err := r.splitPath(fpath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return nodes[len(nodes)-2], target, parts[len(parts)-1], nil
+}
+
+// prefetchTimeout bounds the time ResolveWithSiblings spends prefetching
+// the siblings of the node it resolves.
+const prefetchTimeout = time.Minute
+
+// ResolveWithSiblings fetches the node for given path like ResolvePath, and
+// also returns the other links of its parent, e.g. the other entries of the
+// directory it is in. The nodes they link to are prefetched from the DAG in
+// the background, for DAGs which cache what they fetch: the call doesn't
+// wait for the prefetch, which goes on for at most prefetchTimeout, unless
+// the target fails to resolve. A root node has no siblings.
+func (r *Resolver) ResolveWithSiblings(ctx context.Context, fpath path.Path) (dms3ld.Node, []*dms3ld.Link, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, err
+	}
+
+	c, parts, err := r.splitPath(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var st *resolveStats
+	if r.MaxTotalBytes > 0 {
+		st = new(resolveStats)
+	}
+	if len(parts) == 0 {
+		nd, err := r.getNode(ctx, c, st)
+		return nd, nil, err
+	}
+
+	// the parent keeps the protocol of fpath, so that both are resolved
+	// with the same options
+	cpath, err := path.ParsePath(fpath.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	segs := cpath.Segments()
+	name := parts[len(parts)-1]
+	parents, err := r.resolvePathComponents(ctx, path.FromString("/"+path.Join(segs[:len(segs)-1])), st)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent := parents[len(parents)-1]
+
+	var siblings []*dms3ld.Link
+	var cids []*cid.Cid
+	for _, lnk := range parent.Links() {
+		if lnk.Name != name {
+			siblings = append(siblings, lnk)
+			cids = append(cids, lnk.Cid)
+		}
+	}
+
+	// the prefetch outlives the call, so it gets a context of its own
+	pctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	getter := r.DAG
+	go func() {
+		defer cancel()
+		for range getter.GetMany(pctx, cids) {
+		}
+	}()
+
+	nodes, err := r.resolveLinks(ctx, parent, []string{name}, r.OptionsFor(fpath), st)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return nodes[len(nodes)-1], siblings, nil
+}
+
+// ResolveWithProof fetches the node for given path along with every node on
+// the way to it, starting with the root node. Each node of the proof links to
+// the next one, the last one being the resolved node itself, so a client
+// holding the root cid can verify the resolution independently.
+func (r *Resolver) ResolveWithProof(ctx context.Context, fpath path.Path) (dms3ld.Node, []dms3ld.Node, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil || nodes == nil {
+		return nil, nil, err
+	}
+	return nodes[len(nodes)-1], nodes, nil
+}
+
+// ResolvePathFull fetches the node for given path and returns it along with
+// the canonical form of the path and every node on the way to it, starting
+// with the root node.
+func (r *Resolver) ResolvePathFull(ctx context.Context, fpath path.Path) (dms3ld.Node, path.Path, []dms3ld.Node, error) {
+	canonical, err := path.ParsePath(fpath.String())
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, canonical)
+	if err != nil || nodes == nil {
+		return nil, "", nil, err
+	}
+	return nodes[len(nodes)-1], canonical, nodes, nil
+}
+
 // ResolveSingle simply resolves one hop of a path through a graph with no
 // extra context (does not opaquely resolve through sharded nodes)
 func ResolveSingle(ctx context.Context, ds dms3ld.NodeGetter, nd dms3ld.Node, names []string) (*dms3ld.Link, []string, error) {
 	return nd.ResolveLink(names)
 }
 
+// ResolveTimed fetches the node for given path like ResolvePath, and also
+// returns how long each hop of the resolution took, in order. This is useful
+// to find out which hop of a slow resolution is to blame.
+func (r *Resolver) ResolveTimed(ctx context.Context, fpath path.Path) (dms3ld.Node, []HopTiming, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, err
+	}
+
+	st := new(resolveStats)
+	nodes, err := r.resolvePathComponents(ctx, fpath, st)
+	if err != nil || nodes == nil {
+		return nil, st.timings, err
+	}
+	return nodes[len(nodes)-1], st.timings, nil
+}
+
+// ResolveTraced fetches the node for given path like ResolvePath, and also
+// returns the events recorded along the way, in order. This exposes the
+// timeline of a single resolution without enabling the global event log.
+func (r *Resolver) ResolveTraced(ctx context.Context, fpath path.Path) (dms3ld.Node, []Event, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, err
+	}
+
+	st := new(resolveStats)
+	nodes, err := r.resolvePathComponents(ctx, fpath, st)
+	if err != nil || nodes == nil {
+		return nil, st.events, err
+	}
+	return nodes[len(nodes)-1], st.events, nil
+}
+
+// ResolveStale fetches the node for given path like ResolvePath, and also
+// returns whether any node on the way was served from Cache because it
+// couldn't be fetched, in which case the result may be out of date.
+func (r *Resolver) ResolveStale(ctx context.Context, fpath path.Path) (dms3ld.Node, bool, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, false, err
+	}
+
+	st := new(resolveStats)
+	nodes, err := r.resolvePathComponents(ctx, fpath, st)
+	if err != nil || nodes == nil {
+		return nil, false, err
+	}
+	return nodes[len(nodes)-1], st.stale, nil
+}
+
+// ResolveInfo describes how much work a resolution took.
+type ResolveInfo struct {
+	// TraversedLinks is false when the path was just a root cid.
+	TraversedLinks bool
+	// HopCount is the number of links followed from the root.
+	HopCount int
+}
+
+// ResolveDetailed fetches the node for given path like ResolvePath, and also
+// returns how much work the resolution took, e.g. to tell cheap root lookups
+// from expensive traversals.
+func (r *Resolver) ResolveDetailed(ctx context.Context, fpath path.Path) (dms3ld.Node, ResolveInfo, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, ResolveInfo{}, err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil || nodes == nil {
+		return nil, ResolveInfo{}, err
+	}
+
+	hops := len(nodes) - 1
+	return nodes[hops], ResolveInfo{TraversedLinks: hops > 0, HopCount: hops}, nil
+}
+
+// ResolveNameDetailed fetches the node for given path like ResolvePath. The
+// name of a dms3ns path is first resolved with ResolveName, whose record
+// metadata is returned along with the node. Other paths are resolved as
+// is, with empty metadata.
+func (r *Resolver) ResolveNameDetailed(ctx context.Context, fpath path.Path) (dms3ld.Node, NameRecordMeta, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, NameRecordMeta{}, err
+	}
+
+	var meta NameRecordMeta
+	if parts := fpath.Segments(); parts[0] == "dms3ns" {
+		if r.ResolveName == nil {
+			return nil, NameRecordMeta{}, errors.New("resolver has no ResolveName")
+		}
+
+		target, m, err := r.ResolveName(ctx, parts[1])
+		if err != nil {
+			return nil, NameRecordMeta{}, err
+		}
+		fpath, err = path.ParsePath(path.Join(append([]string{target.String()}, parts[2:]...)))
+		if err != nil {
+			return nil, NameRecordMeta{}, err
+		}
+		meta = m
+	}
+
+	nd, err := r.ResolvePath(ctx, fpath)
+	if err != nil {
+		return nil, NameRecordMeta{}, err
+	}
+	return nd, meta, nil
+}
+
+// ResolveETag resolves fpath and returns a strong HTTP ETag for it, quotes
+// included. The ETag is built from the cid of the resolved node, which
+// changes with its content. For dms3ns paths it also includes the cid the
+// name resolved to, so it changes whenever the name is repointed.
+func (r *Resolver) ResolveETag(ctx context.Context, fpath path.Path) (string, error) {
+	if err := fpath.IsValid(); err != nil {
+		return "", err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil {
+		return "", err
+	}
+	return etag(fpath, nodes), nil
+}
+
+// etag implements ResolveETag given the nodes fpath resolved to.
+func etag(fpath path.Path, nodes []dms3ld.Node) string {
+	tag := nodes[len(nodes)-1].Cid().String()
+	if path.Protocol(fpath.String()) == "dms3ns" {
+		tag = nodes[0].Cid().String() + "-" + tag
+	}
+	return `"` + tag + `"`
+}
+
 // ResolvePathComponents fetches the nodes for each segment of the given path.
 // It uses the first path component as a hash (key) of the first node, then
 // resolves all other components walking the links, with ResolveLinks.
 func (r *Resolver) ResolvePathComponents(ctx context.Context, fpath path.Path) ([]dms3ld.Node, error) {
+	if r.CoalesceResolutions {
+		return r.flights.do(ctx, fpath.CacheKey(), func(ctx context.Context) ([]dms3ld.Node, error) {
+			return r.resolvePathComponents(ctx, fpath, nil)
+		})
+	}
+	return r.resolvePathComponents(ctx, fpath, nil)
+}
+
+func (r *Resolver) resolvePathComponents(ctx context.Context, fpath path.Path, st *resolveStats) ([]dms3ld.Node, error) {
 	evt := log.EventBegin(ctx, "resolvePathComponents", logging.LoggableMap{"fpath": fpath})
 	defer evt.Done()
+	if st == nil && r.MaxTotalBytes > 0 {
+		st = new(resolveStats)
+	}
+	st.record("resolvePathComponents", logging.LoggableMap{"fpath": fpath})
 
-	h, parts, err := path.SplitAbsPath(fpath)
+	opts := r.OptionsFor(fpath)
+	ctx, cancel := withTimeout(ctx, opts)
+	defer cancel()
+
+	if len(r.Overlay) > 0 {
+		if nodes, ok, err := r.resolveOverlay(ctx, fpath, opts, st); ok {
+			if err != nil {
+				appendError(evt, st, err)
+			}
+			return nodes, err
+		}
+	}
+
+	h, parts, err := r.splitPath(fpath)
 	if err != nil {
-		evt.Append(logging.LoggableMap{"error": err.Error()})
+		appendError(evt, st, err)
 		return nil, err
 	}
 
 	log.Debug("resolve dag get")
-	nd, err := r.DAG.Get(ctx, h)
+	nd, err := r.getNode(ctx, h, st)
 	if err != nil {
-		evt.Append(logging.LoggableMap{"error": err.Error()})
+		appendError(evt, st, err)
 		return nil, err
 	}
 
-	return r.ResolveLinks(ctx, nd, parts)
+	return r.resolveLinks(ctx, nd, parts, opts, st)
+}
+
+// ErrNotPinned is returned by NearestPinnedRoot when no node on a path is
+// pinned.
+var ErrNotPinned = errors.New("no pinned root on path")
+
+// NearestPinnedRoot resolves fpath and returns the deepest prefix of it
+// which is in pinned, either as is or as the path of the cid it resolved
+// to. It fails with ErrNotPinned when none is.
+func (r *Resolver) NearestPinnedRoot(ctx context.Context, fpath path.Path, pinned path.PathSet) (path.Path, error) {
+	if err := fpath.IsValid(); err != nil {
+		return "", err
+	}
+
+	nodes, err := r.ResolvePathComponents(ctx, fpath)
+	if err != nil {
+		return "", err
+	}
+
+	fpath, err = path.ParsePath(fpath.String())
+	if err != nil {
+		return "", err
+	}
+	segs := fpath.Segments()
+	for i := len(segs); i >= 2; i-- {
+		prefix := path.FromString("/" + path.Join(segs[:i]))
+		if pinned.Has(prefix) {
+			return prefix, nil
+		}
+		// nodes are only known to line up with segments when each hop
+		// resolved a single one.
+		if len(nodes) == len(segs)-1 && pinned.Has(path.FromCid(nodes[i-2].Cid())) {
+			return prefix, nil
+		}
+	}
+	return "", ErrNotPinned
+}
+
+// ResolutionState is the progress of a resolution: the cid of the last node
+// reached and the path components left to resolve from it. It can be kept
+// to resume an interrupted resolution with ResumeResolution.
+type ResolutionState struct {
+	Cid       *cid.Cid
+	Remaining []string
+}
+
+// ResolveResumable fetches the node for given path like ResolvePath. When
+// resolution fails midway, e.g. because the context is canceled or a node
+// can't be fetched, the state reached so far is returned along with the
+// error, for ResumeResolution to continue from.
+func (r *Resolver) ResolveResumable(ctx context.Context, fpath path.Path) (dms3ld.Node, *ResolutionState, error) {
+	if err := fpath.IsValid(); err != nil {
+		return nil, nil, err
+	}
+
+	c, parts, err := r.splitPath(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.ResumeResolution(ctx, ResolutionState{Cid: c, Remaining: parts})
+}
+
+// ResumeResolution continues a resolution from the given state, with the
+// options of the dms3fs protocol. It behaves like ResolveResumable,
+// returning a new state when it fails again. The cid of the state is
+// checked against AllowedRoots like the root of a path.
+func (r *Resolver) ResumeResolution(ctx context.Context, state ResolutionState) (dms3ld.Node, *ResolutionState, error) {
+	if err := r.checkRoot(state.Cid); err != nil {
+		return nil, &state, err
+	}
+
+	st := &resolveStats{remaining: state.Remaining}
+	nd, err := r.getNode(ctx, state.Cid, st)
+	if err != nil {
+		return nil, &state, err
+	}
+
+	nodes, err := r.resolveLinks(ctx, nd, state.Remaining, r.OptionsFor(path.FromCid(state.Cid)), st)
+	if err != nil {
+		return nil, &ResolutionState{Cid: nodes[len(nodes)-1].Cid(), Remaining: st.remaining}, err
+	}
+	return nodes[len(nodes)-1], nil, nil
+}
+
+// ResolveFromNode resolves subpath, a slash separated list of link names,
+// starting from the given node instead of fetching a root from the DAG. It
+// returns the list of nodes forming the path, starting with root.
+func (r *Resolver) ResolveFromNode(ctx context.Context, root dms3ld.Node, subpath string) ([]dms3ld.Node, error) {
+	var names []string
+	for _, name := range path.SplitList(subpath) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return r.ResolveLinks(ctx, root, names)
 }
 
 // ResolveLinks iteratively resolves names by walking the link hierarchy.
@@ -167,37 +850,254 @@ func (r *Resolver) ResolvePathComponents(ctx context.Context, fpath path.Path) (
 // ResolveLinks(nd, []string{"foo", "bar", "baz"})
 // would retrieve "baz" in ("bar" in ("foo" in nd.Links).Links).Links
 func (r *Resolver) ResolveLinks(ctx context.Context, ndd dms3ld.Node, names []string) ([]dms3ld.Node, error) {
+	return r.resolveLinks(ctx, ndd, names, r.OptionsFor(""), nil)
+}
 
+// resolveLinks implements ResolveLinks with the given options. When st is not
+// nil, information about every hop is recorded into it.
+func (r *Resolver) resolveLinks(ctx context.Context, ndd dms3ld.Node, names []string, opts ResolverOptions, st *resolveStats) ([]dms3ld.Node, error) {
 	evt := log.EventBegin(ctx, "resolveLinks", logging.LoggableMap{"names": names})
 	defer evt.Done()
+	if st == nil && r.MaxTotalBytes > 0 {
+		st = new(resolveStats)
+	}
+	st.record("resolveLinks", logging.LoggableMap{"names": names})
 	result := make([]dms3ld.Node, 0, len(names)+1)
 	result = append(result, ndd)
 	nd := ndd // dup arg workaround
 
+	ctx, cancel := withTimeout(ctx, opts)
+	defer cancel()
+
+	var wrappers map[string]bool
+
 	// for each of the path components
 	for len(names) > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Minute)
+		if err := ctx.Err(); err != nil {
+			appendError(evt, st, err)
+			return result, err
+		}
+
+		hopCtx, cancel := context.WithTimeout(ctx, hopTimeout(ctx, opts, len(names)))
 		defer cancel()
 
-		lnk, rest, err := r.ResolveOnce(ctx, r.DAG, nd, names)
+		start := time.Now()
+		lnk, rest, err := r.resolveOnce(hopCtx, opts, nd, names)
+		if err == dag.ErrLinkNotFound && r.AutoFollowSingleLink {
+			if wrappers == nil {
+				wrappers = make(map[string]bool)
+			}
+			if links := nd.Links(); len(links) == 1 && !wrappers[contentKey(links[0].Cid)] {
+				wrappers[contentKey(links[0].Cid)] = true
+				lnk, rest, err = links[0], names, nil
+			}
+		}
+		if err == dag.ErrLinkNotFound && r.OnLinkNotFound != nil {
+			var found *dms3ld.Link
+			found, err = r.OnLinkNotFound(hopCtx, nd, names[0])
+			if err == nil && found != nil {
+				lnk, rest = found, names[1:]
+			} else if err == nil {
+				err = dag.ErrLinkNotFound
+			}
+		}
 		if err == dag.ErrLinkNotFound {
-			evt.Append(logging.LoggableMap{"error": err.Error()})
+			appendError(evt, st, err)
 			return result, ErrNoLink{Name: names[0], Node: nd.Cid()}
 		} else if err != nil {
-			evt.Append(logging.LoggableMap{"error": err.Error()})
+			appendError(evt, st, err)
 			return result, err
 		}
 
-		nextnode, err := lnk.GetNode(ctx, r.DAG)
+		nextnode, err := r.getNode(hopCtx, lnk.Cid, st)
 		if err != nil {
-			evt.Append(logging.LoggableMap{"error": err.Error()})
+			appendError(evt, st, err)
 			return result, err
 		}
 
+		if st != nil {
+			name := path.Join(names[:len(names)-len(rest)])
+			st.timings = append(st.timings, HopTiming{
+				Name:     name,
+				Cid:      nextnode.Cid(),
+				Duration: time.Since(start),
+			})
+			st.record("resolveHop", logging.LoggableMap{"name": name, "cid": nextnode.Cid().String()})
+		}
+
 		nd = nextnode
 		result = append(result, nextnode)
 		names = rest
+		if st != nil {
+			st.remaining = rest
+		}
 	}
 	return result, nil
 }
+
+// resolveOnce resolves one hop with ResolveOnce, falling back to
+// ResolveSingle when FallbackToRawIPLD is set. The error of ResolveOnce is
+// kept when the fallback fails too. When CidSegmentsAreJumps is set, a cid
+// as first name is resolved to itself.
+func (r *Resolver) resolveOnce(ctx context.Context, opts ResolverOptions, nd dms3ld.Node, names []string) (*dms3ld.Link, []string, error) {
+	if r.CidSegmentsAreJumps {
+		if c, err := cid.Decode(names[0]); err == nil {
+			// a jump re-roots the resolution
+			if err := r.checkRoot(c); err != nil {
+				return nil, nil, err
+			}
+			return &dms3ld.Link{Name: names[0], Cid: c}, names[1:], nil
+		}
+	}
+
+	lnk, rest, err := opts.ResolveOnce(ctx, r.DAG, nd, names)
+	if err != nil && r.FallbackToRawIPLD && ctx.Err() == nil {
+		if flnk, frest, ferr := ResolveSingle(ctx, r.DAG, nd, names); ferr == nil {
+			return flnk, frest, nil
+		}
+	}
+	return lnk, rest, err
+}
+
+// splitPath is like path.SplitAbsPath, also resolving dms3ns paths through
+// StaticRoots when it is set, and enforcing AllowedRoots.
+func (r *Resolver) splitPath(fpath path.Path) (*cid.Cid, []string, error) {
+	c, parts, err := r.splitRoot(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.checkRoot(c); err != nil {
+		return nil, nil, err
+	}
+	return c, parts, nil
+}
+
+func (r *Resolver) splitRoot(fpath path.Path) (*cid.Cid, []string, error) {
+	if r.StaticRoots != nil {
+		if parts := fpath.Segments(); len(parts) >= 2 && parts[0] == "dms3ns" {
+			c, ok := r.StaticRoots[parts[1]]
+			if !ok {
+				return nil, nil, ErrUnknownRoot{Name: parts[1]}
+			}
+			return c, parts[2:], nil
+		}
+	}
+	return path.SplitAbsPath(fpath)
+}
+
+// checkRoot fails with ErrRootNotAllowed when c isn't in AllowedRoots.
+func (r *Resolver) checkRoot(c *cid.Cid) error {
+	if r.AllowedRoots == nil || r.AllowedRoots.Has(c) {
+		return nil
+	}
+	if alt := otherVersion(c); alt != nil && r.AllowedRoots.Has(alt) {
+		return nil
+	}
+	return ErrRootNotAllowed{Cid: c}
+}
+
+// getNode fetches the node with the given cid from the DAG, trying the other
+// cid version of the same content when it isn't found, falling back to the
+// cache when ServeStaleOnError is set, and enforces MaxNodeSize and, when
+// st is not nil, MaxTotalBytes.
+func (r *Resolver) getNode(ctx context.Context, c *cid.Cid, st *resolveStats) (dms3ld.Node, error) {
+	nd, err := r.fetchNode(ctx, c, st)
+	if err != nil {
+		return nil, err
+	}
+	size := len(nd.RawData())
+	if r.MaxNodeSize > 0 && size > r.MaxNodeSize {
+		return nil, ErrNodeTooLarge{Cid: c, Size: size}
+	}
+	if st != nil && r.MaxTotalBytes > 0 {
+		st.fetched += int64(size)
+		if st.fetched > r.MaxTotalBytes {
+			return nil, ErrByteBudgetExceeded
+		}
+	}
+	return nd, nil
+}
+
+// staleCacheTimeout bounds the time the Cache may take to serve a stale
+// node once the fetch from the DAG has run out of time.
+const staleCacheTimeout = 5 * time.Second
+
+// fetchNode implements getNode, without checking the size of the node.
+func (r *Resolver) fetchNode(ctx context.Context, c *cid.Cid, st *resolveStats) (dms3ld.Node, error) {
+	nd, err := r.DAG.Get(ctx, c)
+	if err == dms3ld.ErrNotFound {
+		// the block may be stored under the other cid version
+		if alt := otherVersion(c); alt != nil {
+			if altNd, altErr := r.DAG.Get(ctx, alt); altErr == nil {
+				return altNd, nil
+			}
+		}
+	}
+	if err == nil || !r.ServeStaleOnError || r.Cache == nil || ctx.Err() == context.Canceled {
+		return nd, err
+	}
+
+	// A fetch hanging until the deadline of its hop, e.g. during a network
+	// partition, is a failure like any other; only a canceled resolution
+	// isn't served. The cache then gets a context of its own.
+	cctx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(context.Background(), staleCacheTimeout)
+		defer cancel()
+	}
+
+	cached, cerr := r.Cache.Get(cctx, c)
+	if cerr != nil {
+		return nil, err
+	}
+	log.Debugf("serving stale %s after fetch failure: %s", c, err)
+	if st != nil {
+		st.stale = true
+	}
+	return cached, nil
+}
+
+// withTimeout bounds ctx by the Timeout of opts, if any.
+func withTimeout(ctx context.Context, opts ResolverOptions) (context.Context, context.CancelFunc) {
+	if opts.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, opts.Timeout)
+}
+
+// hopTimeout returns the time the next hop of a resolution may take, given
+// the number of path components left to resolve.
+func hopTimeout(ctx context.Context, opts ResolverOptions, remaining int) time.Duration {
+	if opts.Timeout <= 0 {
+		return time.Minute
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return opts.Timeout / time.Duration(remaining)
+	}
+	return time.Until(deadline) / time.Duration(remaining)
+}
+
+// progress counts the nodes processed by a traversal and reports them to
+// the Progress callback of a resolver.
+type progress struct {
+	fn        func(processed, total int)
+	processed int
+	total     int
+}
+
+// newProgress returns a progress reporting to the Progress callback of r,
+// for a traversal of total nodes, or -1 if unknown.
+func (r *Resolver) newProgress(total int) *progress {
+	return &progress{fn: r.Progress, total: total}
+}
+
+// step records that one more node has been processed.
+func (p *progress) step() {
+	p.processed++
+	if p.fn != nil {
+		p.fn(p.processed, p.total)
+	}
+}
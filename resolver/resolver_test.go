@@ -2,14 +2,17 @@ package resolver_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"testing"
 	"time"
 
 	path "github.com/dms3-fs/go-path"
 	"github.com/dms3-fs/go-path/resolver"
 
+	cid "github.com/dms3-fs/go-cid"
 	dms3ld "github.com/dms3-fs/go-ld-format"
 	merkledag "github.com/dms3-fs/go-merkledag"
 	dagmock "github.com/dms3-fs/go-merkledag/test"
@@ -106,3 +109,1443 @@ func TestRecurivePathResolution(t *testing.T) {
 			p.String(), rCid.String(), cKey.String()))
 	}
 }
+
+// newFixture builds the a -child-> b -grandchild-> c DAG used by most tests
+// and returns the dag service holding it along with the three nodes.
+func newFixture(t *testing.T) (dms3ld.DAGService, []*merkledag.ProtoNode) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	a := randNode()
+	b := randNode()
+	c := randNode()
+
+	if err := b.AddNodeLink("grandchild", c); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddNodeLink("child", b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []dms3ld.Node{a, b, c} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dagService, []*merkledag.ProtoNode{a, b, c}
+}
+
+func TestResolveTimed(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	nd, timings, err := r.ResolveTimed(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	if len(timings) != 2 {
+		t.Fatalf("expected one timing per hop (2), got %d", len(timings))
+	}
+
+	for i, name := range []string{"child", "grandchild"} {
+		if timings[i].Name != name {
+			t.Errorf("expected hop %d to be %q, got %q", i, name, timings[i].Name)
+		}
+		if !timings[i].Cid.Equals(nodes[i+1].Cid()) {
+			t.Errorf("expected hop %d to arrive at %s, got %s", i, nodes[i+1].Cid(), timings[i].Cid)
+		}
+	}
+}
+
+func TestResolveWithParent(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent, target, name, err := r.ResolveWithParent(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parent.Cid().Equals(nodes[1].Cid()) {
+		t.Errorf("expected parent %s, got %s", nodes[1].Cid(), parent.Cid())
+	}
+	if !target.Cid().Equals(nodes[2].Cid()) {
+		t.Errorf("expected target %s, got %s", nodes[2].Cid(), target.Cid())
+	}
+	if name != "grandchild" {
+		t.Errorf("expected name \"grandchild\", got %q", name)
+	}
+
+	parent, target, name, err = r.ResolveWithParent(ctx, path.FromCid(nodes[0].Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != nil || name != "" {
+		t.Errorf("expected no parent for a root path, got %v %q", parent, name)
+	}
+	if !target.Cid().Equals(nodes[0].Cid()) {
+		t.Errorf("expected target %s, got %s", nodes[0].Cid(), target.Cid())
+	}
+}
+
+func TestResolveWithProof(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, proof, err := r.ResolveWithProof(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proof) != 3 {
+		t.Fatalf("expected a proof of 3 nodes, got %d", len(proof))
+	}
+	if !proof[0].Cid().Equals(nodes[0].Cid()) {
+		t.Fatalf("expected proof to start at the root %s, got %s", nodes[0].Cid(), proof[0].Cid())
+	}
+	if !proof[len(proof)-1].Cid().Equals(nd.Cid()) {
+		t.Fatalf("expected proof to end at the resolved node %s, got %s", nd.Cid(), proof[len(proof)-1].Cid())
+	}
+
+	for i := 0; i < len(proof)-1; i++ {
+		linked := false
+		for _, lnk := range proof[i].Links() {
+			if lnk.Cid.Equals(proof[i+1].Cid()) {
+				linked = true
+			}
+		}
+		if !linked {
+			t.Fatalf("proof node %s does not link to %s", proof[i].Cid(), proof[i+1].Cid())
+		}
+	}
+}
+
+func TestResolveToLastCidFast(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := r.ResolveToLastCidFast(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), c)
+	}
+
+	p, err = path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolveToLastCidFast(ctx, p); err == nil {
+		t.Fatal("expected resolving a missing link to fail")
+	}
+}
+
+func benchmarkResolveToLast(b *testing.B, resolve func(*resolver.Resolver, context.Context, path.Path) error) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	// a chain of 10 nodes with some data in each
+	segs := make([]string, 0, 10)
+	next := randNode()
+	if err := dagService.Add(ctx, next); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 9; i++ {
+		nd := randNode()
+		if err := nd.AddNodeLink("next", next); err != nil {
+			b.Fatal(err)
+		}
+		if err := dagService.Add(ctx, nd); err != nil {
+			b.Fatal(err)
+		}
+		segs = append(segs, "next")
+		next = nd
+	}
+
+	p, err := path.FromSegments("/dms3fs/", append([]string{next.Cid().String()}, segs...)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := resolve(r, ctx, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolveToLastNode(b *testing.B) {
+	benchmarkResolveToLast(b, func(r *resolver.Resolver, ctx context.Context, p path.Path) error {
+		_, _, err := r.ResolveToLastNode(ctx, p)
+		return err
+	})
+}
+
+func BenchmarkResolveToLastCidFast(b *testing.B) {
+	benchmarkResolveToLast(b, func(r *resolver.Resolver, ctx context.Context, p path.Path) error {
+		_, err := r.ResolveToLastCidFast(ctx, p)
+		return err
+	})
+}
+
+// slowGetter delays every fetch of the wrapped NodeGetter, giving up early
+// when the context expires.
+type slowGetter struct {
+	dms3ld.NodeGetter
+	delay time.Duration
+}
+
+func (g slowGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	select {
+	case <-time.After(g.delay):
+		return g.NodeGetter.Get(ctx, c)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestTotalTimeout(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &resolver.Resolver{
+		DAG:          slowGetter{dagService, 20 * time.Millisecond},
+		ResolveOnce:  resolver.ResolveSingle,
+		TotalTimeout: 30 * time.Millisecond,
+	}
+
+	start := time.Now()
+	if _, err := r.ResolvePath(ctx, p); err != context.DeadlineExceeded {
+		t.Fatalf("expected the total budget to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("resolution took %s, way over its total budget", elapsed)
+	}
+
+	r.TotalTimeout = time.Second
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+}
+
+func TestResolveTraced(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, events, err := r.ResolveTraced(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hops []string
+	for _, e := range events {
+		if e.Name == "resolveHop" {
+			hops = append(hops, e.Metadata["name"].(string))
+		}
+	}
+	if len(hops) != 2 || hops[0] != "child" || hops[1] != "grandchild" {
+		t.Fatalf("expected the trace to contain both hops, got %v", hops)
+	}
+
+	p, err = path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, events, err = r.ResolveTraced(ctx, p)
+	if err == nil {
+		t.Fatal("expected resolving a missing link to fail")
+	}
+	if last := events[len(events)-1]; last.Name != "error" {
+		t.Fatalf("expected the trace to end with the error, got %q", last.Name)
+	}
+}
+
+func TestResolvePathFull(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	root := nodes[0].Cid().String()
+	nd, canonical, chain, err := r.ResolvePathFull(ctx, path.FromString(root+"//child/grandchild/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+	if canonical.String() != "/dms3fs/"+root+"/child/grandchild" {
+		t.Fatalf("unexpected canonical path %s", canonical)
+	}
+	if len(chain) != len(nodes) {
+		t.Fatalf("expected %d nodes, got %d", len(nodes), len(chain))
+	}
+	for i := range nodes {
+		if !chain[i].Cid().Equals(nodes[i].Cid()) {
+			t.Fatalf("expected node %d to be %s, got %s", i, nodes[i].Cid(), chain[i].Cid())
+		}
+	}
+}
+
+// failingGetter fails to fetch the nodes in fail, as if they were
+// unreachable, and fetches the others from the wrapped NodeGetter.
+type failingGetter struct {
+	dms3ld.NodeGetter
+	fail *cid.Set
+}
+
+func (g failingGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	if g.fail.Has(c) {
+		return nil, errors.New("network unreachable")
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fail := cid.NewSet()
+	fail.Add(nodes[2].Cid())
+	r := &resolver.Resolver{
+		DAG:         failingGetter{dagService, fail},
+		ResolveOnce: resolver.ResolveSingle,
+		Cache:       dagService,
+	}
+
+	if _, _, err := r.ResolveStale(ctx, p); err == nil {
+		t.Fatal("expected resolution to fail without ServeStaleOnError")
+	}
+
+	r.ServeStaleOnError = true
+	nd, stale, err := r.ResolveStale(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stale {
+		t.Fatal("expected the result to be flagged as stale")
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	fail.Remove(nodes[2].Cid())
+	_, stale, err = r.ResolveStale(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale {
+		t.Fatal("expected a fresh result once the nodes can be fetched")
+	}
+}
+
+// hangingGetter blocks on fetching the nodes in hang until its context is
+// done, as if the network was partitioned, and fetches the others from the
+// wrapped NodeGetter.
+type hangingGetter struct {
+	dms3ld.NodeGetter
+	hang *cid.Set
+}
+
+func (g hangingGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	if g.hang.Has(c) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func TestServeStaleOnTimeout(t *testing.T) {
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hang := cid.NewSet()
+	hang.Add(nodes[1].Cid())
+	r := &resolver.Resolver{
+		DAG:               hangingGetter{dagService, hang},
+		ResolveOnce:       resolver.ResolveSingle,
+		Cache:             dagService,
+		ServeStaleOnError: true,
+		TotalTimeout:      200 * time.Millisecond,
+	}
+
+	// the hop to child runs out of time, the rest of the resolution doesn't
+	nd, stale, err := r.ResolveStale(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stale {
+		t.Fatal("expected the result to be flagged as stale")
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	// a canceled resolution is not served from the cache
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, _, err := r.ResolveStale(ctx, p); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestResolveFromNode(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	// an in-memory root, never added to the dag service
+	root := randNode()
+	if err := root.AddNodeLink("dir", nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := r.ResolveFromNode(ctx, root, "dir/child/grandchild/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(resolved))
+	}
+	if resolved[0] != dms3ld.Node(root) {
+		t.Fatal("expected the given root to be the first node")
+	}
+	if !resolved[3].Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), resolved[3].Cid())
+	}
+
+	resolved, err = r.ResolveFromNode(ctx, root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 {
+		t.Fatalf("expected just the root for an empty subpath, got %d nodes", len(resolved))
+	}
+}
+
+// mapNode is a minimal generic IPLD node standing in for DAG-CBOR nodes: it
+// holds named fields, the ones holding a *cid.Cid being links.
+type mapNode struct {
+	cid    *cid.Cid
+	data   []byte
+	fields map[string]interface{}
+}
+
+func newMapNode(t testing.TB, fields map[string]interface{}) *mapNode {
+	data := []byte(fmt.Sprint(fields))
+	pref := merkledag.NewRawNode(nil).Cid().Prefix()
+	pref.Version = 1
+	pref.Codec = cid.DagCBOR
+	c, err := pref.Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mapNode{cid: c, data: data, fields: fields}
+}
+
+func (n *mapNode) RawData() []byte                   { return n.data }
+func (n *mapNode) Cid() *cid.Cid                     { return n.cid }
+func (n *mapNode) String() string                    { return n.cid.String() }
+func (n *mapNode) Loggable() map[string]interface{}  { return map[string]interface{}{"node": n.cid} }
+func (n *mapNode) Copy() dms3ld.Node                 { return n }
+func (n *mapNode) Tree(p string, depth int) []string { return nil }
+func (n *mapNode) Stat() (*dms3ld.NodeStat, error)   { return &dms3ld.NodeStat{}, nil }
+func (n *mapNode) Size() (uint64, error)             { return uint64(len(n.data)), nil }
+
+func (n *mapNode) Resolve(p []string) (interface{}, []string, error) {
+	if len(p) == 0 {
+		return n.fields, nil, nil
+	}
+	v, ok := n.fields[p[0]]
+	if !ok {
+		return nil, nil, errors.New("no such field")
+	}
+	if c, ok := v.(*cid.Cid); ok {
+		return &dms3ld.Link{Name: p[0], Cid: c}, p[1:], nil
+	}
+	if len(p) > 1 {
+		return nil, nil, errors.New("not a link")
+	}
+	return v, nil, nil
+}
+
+func (n *mapNode) ResolveLink(p []string) (*dms3ld.Link, []string, error) {
+	v, rest, err := n.Resolve(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	lnk, ok := v.(*dms3ld.Link)
+	if !ok {
+		return nil, nil, errors.New("not a link")
+	}
+	return lnk, rest, nil
+}
+
+func (n *mapNode) Links() []*dms3ld.Link {
+	var links []*dms3ld.Link
+	for name, v := range n.fields {
+		if c, ok := v.(*cid.Cid); ok {
+			links = append(links, &dms3ld.Link{Name: name, Cid: c})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+	return links
+}
+
+// extraGetter serves the given nodes on top of the ones of its NodeGetter.
+type extraGetter struct {
+	dms3ld.NodeGetter
+	nodes []dms3ld.Node
+}
+
+func (g extraGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	for _, nd := range g.nodes {
+		if nd.Cid().Equals(c) {
+			return nd, nil
+		}
+	}
+	return g.NodeGetter.Get(ctx, c)
+}
+
+// resolveProtoOnly resolves through dag-pb nodes only, like a UnixFS
+// resolver would.
+func resolveProtoOnly(ctx context.Context, ds dms3ld.NodeGetter, nd dms3ld.Node, names []string) (*dms3ld.Link, []string, error) {
+	if _, ok := nd.(*merkledag.ProtoNode); !ok {
+		return nil, nil, errors.New("not a dag-pb node")
+	}
+	return resolver.ResolveSingle(ctx, ds, nd, names)
+}
+
+func TestFallbackToRawIPLD(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	mid := newMapNode(t, map[string]interface{}{
+		"inner": nodes[2].Cid(),
+		"n":     1,
+	})
+	root := randNode()
+	if err := root.AddRawLink("mixed", &dms3ld.Link{Cid: mid.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := path.FromSegments("/dms3fs/", root.Cid().String(), "mixed", "inner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &resolver.Resolver{
+		DAG:         extraGetter{dagService, []dms3ld.Node{mid}},
+		ResolveOnce: resolveProtoOnly,
+	}
+	if _, err := r.ResolvePath(ctx, p); err == nil {
+		t.Fatal("expected resolution through a non dag-pb node to fail")
+	}
+
+	r.FallbackToRawIPLD = true
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+}
+
+func TestProtocolConfig(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	r := &resolver.Resolver{
+		DAG:          slowGetter{dagService, 20 * time.Millisecond},
+		ResolveOnce:  resolver.ResolveSingle,
+		TotalTimeout: time.Second,
+		ProtocolConfig: map[string]resolver.ResolverOptions{
+			"dms3ns": {Timeout: 10 * time.Second},
+			"dms3ld": {Timeout: 30 * time.Millisecond},
+		},
+	}
+
+	if to := r.OptionsFor(path.FromString("/dms3ns/example.com/a")).Timeout; to != 10*time.Second {
+		t.Fatalf("expected dms3ns paths to use their own timeout, got %s", to)
+	}
+	if to := r.OptionsFor(path.FromString("/dms3fs/" + nodes[0].Cid().String())).Timeout; to != time.Second {
+		t.Fatalf("expected dms3fs paths to use the resolver timeout, got %s", to)
+	}
+
+	segs := []string{nodes[0].Cid().String(), "child", "grandchild"}
+	fsPath, err := path.FromSegments("/dms3fs/", segs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, fsPath); err != nil {
+		t.Fatal(err)
+	}
+
+	ldPath, err := path.FromSegments("/dms3ld/", segs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, ldPath); err != context.DeadlineExceeded {
+		t.Fatalf("expected the dms3ld timeout to expire, got %v", err)
+	}
+}
+
+func TestResolveDetailed(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	nd, info, err := r.ResolveDetailed(ctx, path.FromCid(nodes[0].Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[0].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[0].Cid(), nd.Cid())
+	}
+	if info.TraversedLinks || info.HopCount != 0 {
+		t.Fatalf("expected a root-only resolution, got %+v", info)
+	}
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, info, err = r.ResolveDetailed(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+	if !info.TraversedLinks || info.HopCount != 2 {
+		t.Fatalf("expected 2 hops, got %+v", info)
+	}
+}
+
+func TestCidSegmentsAreJumps(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	// a link named after the cid of the grandchild, pointing to the child
+	root := randNode()
+	if err := root.AddNodeLink(nodes[2].Cid().String(), nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := path.FromSegments("/dms3fs/", root.Cid().String(), nodes[2].Cid().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[1].Cid()) {
+		t.Fatalf("expected the segment to be resolved as a name to %s, got %s", nodes[1].Cid(), nd.Cid())
+	}
+
+	r.CidSegmentsAreJumps = true
+	nd, err = r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected the segment to jump to %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	// jumps don't need a matching link
+	p, err = path.FromSegments("/dms3fs/", nodes[1].Cid().String(), nodes[0].Cid().String(), "child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err = r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[1].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[1].Cid(), nd.Cid())
+	}
+}
+
+func TestStaticRoots(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	r := resolver.NewBasicResolver(dagService)
+	r.StaticRoots = map[string]*cid.Cid{
+		"example.com": nodes[0].Cid(),
+	}
+
+	nd, err := r.ResolvePath(ctx, path.FromString("/dms3ns/example.com/child/grandchild"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	_, err = r.ResolvePath(ctx, path.FromString("/dms3ns/unknown.com/child"))
+	if err != (resolver.ErrUnknownRoot{Name: "unknown.com"}) {
+		t.Fatalf("expected ErrUnknownRoot, got %v", err)
+	}
+}
+
+func TestJoinCidAndRest(t *testing.T) {
+	ctx := context.Background()
+	dagService, _ := newFixture(t)
+
+	nd := newMapNode(t, map[string]interface{}{"n": 1})
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = extraGetter{dagService, []dms3ld.Node{nd}}
+
+	p, err := path.FromSegments("/dms3fs/", nd.Cid().String(), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, rest, err := r.ResolveToLastNode(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 {
+		t.Fatalf("expected a data path to remain, got %q", rest)
+	}
+	if joined := path.JoinCidAndRest(c, rest); joined != p {
+		t.Fatalf("expected %s, got %s", p, joined)
+	}
+}
+
+func TestMaxNodeSize(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	big := merkledag.NewRawNode(make([]byte, 1024))
+	if err := nodes[2].AddNodeLink("big", big); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = extraGetter{dagService, []dms3ld.Node{nodes[2], big}}
+	r.MaxNodeSize = 512
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = path.FromSegments("/dms3fs/", nodes[2].Cid().String(), "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ResolvePath(ctx, p)
+	tooLarge, ok := err.(resolver.ErrNodeTooLarge)
+	if !ok {
+		t.Fatalf("expected ErrNodeTooLarge, got %v", err)
+	}
+	if !tooLarge.Cid.Equals(big.Cid()) || tooLarge.Size != 1024 {
+		t.Fatalf("unexpected error %v", tooLarge)
+	}
+}
+
+func TestResolveETag(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := r.ResolveETag(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != `"`+nodes[2].Cid().String()+`"` {
+		t.Fatalf("unexpected etag %s", etag)
+	}
+	again, err := r.ResolveETag(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != etag {
+		t.Fatalf("expected a stable etag, got %s then %s", etag, again)
+	}
+
+	// the same leaf under another root
+	root := randNode()
+	if err := root.AddNodeLink("child", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	name := path.FromString("/dms3ns/example.com/child/grandchild")
+	r.StaticRoots = map[string]*cid.Cid{"example.com": nodes[0].Cid()}
+	before, err := r.ResolveETag(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.StaticRoots["example.com"] = root.Cid()
+	after, err := r.ResolveETag(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Fatalf("expected the etag to change when the name is repointed, got %s", after)
+	}
+}
+
+func TestResolveWithSiblings(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	a := randNode()
+	b := randNode()
+	c := randNode()
+	d := randNode()
+	e := merkledag.NewRawNode([]byte("e"))
+	if err := b.AddNodeLink("grandchild", c); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddNodeLink("other", d); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddNodeLink("raw", e); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddNodeLink("child", b); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{a, b, c, d, e} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	p, err := path.FromSegments("/dms3fs/", a.Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, siblings, err := r.ResolveWithSiblings(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(c.Cid()) {
+		t.Fatalf("expected %s, got %s", c.Cid(), nd.Cid())
+	}
+	if len(siblings) != 2 || siblings[0].Name != "other" || !siblings[0].Cid.Equals(d.Cid()) || siblings[1].Name != "raw" {
+		t.Fatalf("unexpected siblings %v", siblings)
+	}
+
+	nd, siblings, err = r.ResolveWithSiblings(ctx, path.FromCid(a.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(a.Cid()) || siblings != nil {
+		t.Fatalf("expected a root without siblings, got %s and %v", nd.Cid(), siblings)
+	}
+
+	p, err = path.FromSegments("/dms3fs/", a.Cid().String(), "child", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.ResolveWithSiblings(ctx, p); err == nil {
+		t.Fatal("expected a missing target to fail")
+	}
+
+	// the prefetch doesn't hold up the call
+	release := make(chan struct{})
+	defer close(release)
+	r.DAG = stalledPrefetchGetter{dagService, release}
+	p, err = path.FromSegments("/dms3fs/", a.Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := r.ResolveWithSiblings(ctx, p)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected ResolveWithSiblings to return before the prefetch is done")
+	}
+}
+
+func TestResolveWithSiblingsProtocolConfig(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	// every hop of a dms3ld path goes through the dms3ld ResolveOnce
+	var hops []string
+	r := resolver.NewBasicResolver(dagService)
+	r.ProtocolConfig = map[string]resolver.ResolverOptions{
+		"dms3ld": {ResolveOnce: func(ctx context.Context, ds dms3ld.NodeGetter, nd dms3ld.Node, names []string) (*dms3ld.Link, []string, error) {
+			hops = append(hops, names[0])
+			return resolver.ResolveSingle(ctx, ds, nd, names)
+		}},
+	}
+
+	p, err := path.FromSegments("/dms3ld/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.ResolveWithSiblings(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 2 || hops[0] != "child" || hops[1] != "grandchild" {
+		t.Fatalf("expected both hops to use the dms3ld options, got %v", hops)
+	}
+}
+
+// stalledPrefetchGetter never completes GetMany until release is closed.
+type stalledPrefetchGetter struct {
+	dms3ld.NodeGetter
+	release chan struct{}
+}
+
+func (g stalledPrefetchGetter) GetMany(ctx context.Context, cids []*cid.Cid) <-chan *dms3ld.NodeOption {
+	out := make(chan *dms3ld.NodeOption)
+	go func() {
+		defer close(out)
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+		}
+	}()
+	return out
+}
+
+func TestResolveNameDetailed(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	validUntil := time.Now().Add(time.Hour)
+	r := resolver.NewBasicResolver(dagService)
+	r.ResolveName = func(ctx context.Context, name string) (path.Path, resolver.NameRecordMeta, error) {
+		if name != "example.com" {
+			return "", resolver.NameRecordMeta{}, errors.New("no such name")
+		}
+		return path.FromCid(nodes[0].Cid()), resolver.NameRecordMeta{
+			Sequence:   7,
+			ValidUntil: validUntil,
+			TTL:        time.Minute,
+		}, nil
+	}
+
+	nd, meta, err := r.ResolveNameDetailed(ctx, path.FromString("/dms3ns/example.com/child/grandchild"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+	if meta.Sequence != 7 || !meta.ValidUntil.Equal(validUntil) || meta.TTL != time.Minute {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	if _, _, err := r.ResolveNameDetailed(ctx, path.FromString("/dms3ns/unknown.com")); err == nil {
+		t.Fatal("expected an unknown name to fail")
+	}
+
+	nd, meta, err = r.ResolveNameDetailed(ctx, path.FromCid(nodes[1].Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[1].Cid()) || meta != (resolver.NameRecordMeta{}) {
+		t.Fatalf("expected a dms3fs path to resolve without metadata, got %s and %+v", nd.Cid(), meta)
+	}
+}
+
+func TestAutoFollowSingleLink(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	wrapper := randNode()
+	if err := wrapper.AddNodeLink("", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, wrapper); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := path.FromSegments("/dms3fs/", wrapper.Cid().String(), "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	if _, err := r.ResolvePath(ctx, p); err == nil {
+		t.Fatal("expected the wrapper not to be followed by default")
+	}
+
+	r.AutoFollowSingleLink = true
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	// two nodes linking to each other
+	x := &unorderedNode{ProtoNode: merkledag.NodeWithData([]byte("x"))}
+	y := &unorderedNode{ProtoNode: merkledag.NodeWithData([]byte("y"))}
+	x.links = []*dms3ld.Link{{Cid: y.Cid()}}
+	y.links = []*dms3ld.Link{{Cid: x.Cid()}}
+	r.DAG = extraGetter{dagService, []dms3ld.Node{x, y}}
+
+	p, err = path.FromSegments("/dms3fs/", x.Cid().String(), "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, p); err == nil {
+		t.Fatal("expected a loop of wrappers to fail")
+	}
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	// a chain of 5 nodes of about 1KiB each
+	var chain []*merkledag.ProtoNode
+	next := merkledag.NodeWithData(make([]byte, 1024))
+	chain = append(chain, next)
+	for i := 0; i < 4; i++ {
+		nd := merkledag.NodeWithData(make([]byte, 1024+i+1))
+		if err := nd.AddNodeLink("next", next); err != nil {
+			t.Fatal(err)
+		}
+		chain = append([]*merkledag.ProtoNode{nd}, chain...)
+		next = nd
+	}
+	for _, nd := range chain {
+		if err := dagService.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := path.FromSegments("/dms3fs/", chain[0].Cid().String(), "next", "next", "next", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	r.MaxTotalBytes = 10 * 1024
+	if _, err := r.ResolvePath(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	r.MaxTotalBytes = 3 * 1024
+	nodes, err := r.ResolvePathComponents(ctx, p)
+	if err != resolver.ErrByteBudgetExceeded {
+		t.Fatalf("expected ErrByteBudgetExceeded, got %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected resolution to stop after 2 nodes, got %d", len(nodes))
+	}
+
+	if _, _, err := r.ResolveToLastNode(ctx, p); err != resolver.ErrByteBudgetExceeded {
+		t.Fatalf("expected ResolveToLastNode to fail with ErrByteBudgetExceeded, got %v", err)
+	}
+	if _, _, err := r.ResolveWithSiblings(ctx, p); err != resolver.ErrByteBudgetExceeded {
+		t.Fatalf("expected ResolveWithSiblings to fail with ErrByteBudgetExceeded, got %v", err)
+	}
+	state := resolver.ResolutionState{Cid: chain[0].Cid(), Remaining: []string{"next", "next", "next", "next"}}
+	if _, _, err := r.ResumeResolution(ctx, state); err != resolver.ErrByteBudgetExceeded {
+		t.Fatalf("expected ResumeResolution to fail with ErrByteBudgetExceeded, got %v", err)
+	}
+}
+
+func TestHasChanged(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	other := randNode()
+	otherChild := randNode()
+	if err := other.AddNodeLink("child", otherChild); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{other, otherChild} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	r.StaticRoots = map[string]*cid.Cid{"example.com": nodes[0].Cid()}
+	p := path.FromString("/dms3ns/example.com/child")
+
+	changed, c, err := r.HasChanged(ctx, p, nodes[1].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || !c.Equals(nodes[1].Cid()) {
+		t.Fatalf("expected no change, got %t and %s", changed, c)
+	}
+
+	r.StaticRoots["example.com"] = other.Cid()
+	changed, c, err = r.HasChanged(ctx, p, nodes[1].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !c.Equals(otherChild.Cid()) {
+		t.Fatalf("expected a change to %s, got %t and %s", otherChild.Cid(), changed, c)
+	}
+
+	if changed, _, err := r.HasChanged(ctx, p, nil); err != nil || !changed {
+		t.Fatalf("expected an unknown cid to count as changed, got %t and %v", changed, err)
+	}
+}
+
+func TestResumeResolution(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the grandchild is unreachable for now
+	fail := cid.NewSet()
+	fail.Add(nodes[2].Cid())
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = failingGetter{dagService, fail}
+
+	_, state, err := r.ResolveResumable(ctx, p)
+	if err == nil {
+		t.Fatal("expected resolution to be interrupted")
+	}
+	if state == nil || !state.Cid.Equals(nodes[1].Cid()) || len(state.Remaining) != 1 || state.Remaining[0] != "grandchild" {
+		t.Fatalf("expected to be interrupted after the child, got %+v", state)
+	}
+
+	r.DAG = dagService
+	nd, state, err := r.ResumeResolution(ctx, *state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		t.Fatalf("expected no state after completion, got %+v", state)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+}
+
+// pathSet is a PathSet backed by a map.
+type pathSet map[path.Path]bool
+
+func (ps pathSet) Has(p path.Path) bool {
+	return ps[p]
+}
+
+func TestNearestPinnedRoot(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	root := path.FromCid(nodes[0].Cid())
+	child := path.FromString(root.String() + "/child")
+	grandchild := path.FromString(child.String() + "/grandchild")
+
+	p, err := r.NearestPinnedRoot(ctx, grandchild, pathSet{child: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != child {
+		t.Fatalf("expected the pinned parent %s, got %s", child, p)
+	}
+
+	// pinned by cid
+	p, err = r.NearestPinnedRoot(ctx, grandchild, pathSet{path.FromCid(nodes[1].Cid()): true, root: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != child {
+		t.Fatalf("expected the parent pinned by cid %s, got %s", child, p)
+	}
+
+	if _, err := r.NearestPinnedRoot(ctx, child, pathSet{grandchild: true}); err != resolver.ErrNotPinned {
+		t.Fatalf("expected ErrNotPinned, got %v", err)
+	}
+}
+
+func TestAllowedRoots(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	close(getter.gate)
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = getter
+	r.AllowedRoots = cid.NewSet()
+	r.AllowedRoots.Add(nodes[0].Cid())
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	getter.fetches = make(map[string]int)
+	p, err = path.FromSegments("/dms3fs/", nodes[1].Cid().String(), "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ResolvePath(ctx, p)
+	if e, ok := err.(resolver.ErrRootNotAllowed); !ok || !e.Cid.Equals(nodes[1].Cid()) {
+		t.Fatalf("expected ErrRootNotAllowed, got %v", err)
+	}
+	if _, err := r.ResolveSelector(ctx, nodes[1].Cid(), resolver.SelectNode{}); err == nil {
+		t.Fatal("expected selecting from a disallowed root to fail")
+	}
+	_, _, err = r.ResumeResolution(ctx, resolver.ResolutionState{Cid: nodes[1].Cid(), Remaining: []string{"grandchild"}})
+	if _, ok := err.(resolver.ErrRootNotAllowed); !ok {
+		t.Fatalf("expected resuming from a disallowed cid to fail with ErrRootNotAllowed, got %v", err)
+	}
+	if len(getter.fetches) != 0 {
+		t.Fatalf("expected nothing to be fetched for a disallowed root, got %v", getter.fetches)
+	}
+
+	// jumps can't escape the allowed roots
+	r.CidSegmentsAreJumps = true
+	p, err = path.FromSegments("/dms3fs/", nodes[0].Cid().String(), nodes[2].Cid().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolvePath(ctx, p); !isRootNotAllowed(err) {
+		t.Fatalf("expected a jump to a disallowed cid to fail with ErrRootNotAllowed, got %v", err)
+	}
+	if _, _, err := r.ResolveToLastNode(ctx, p); !isRootNotAllowed(err) {
+		t.Fatalf("expected ResolveToLastNode to refuse the jump, got %v", err)
+	}
+	r.AllowedRoots.Add(nodes[2].Cid())
+	if _, err := r.ResolvePath(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func isRootNotAllowed(err error) bool {
+	_, ok := err.(resolver.ErrRootNotAllowed)
+	return ok
+}
+
+func TestMixedCidVersions(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	leaf := randNode()
+	root := randNode()
+	leafV1 := cid.NewCidV1(cid.DagProtobuf, leaf.Cid().Hash())
+	if err := root.AddNodeLink("v0", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddRawLink("v1", &dms3ld.Link{Cid: leafV1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{root, leaf} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := resolver.NewBasicResolver(dagService)
+	rootV1 := cid.NewCidV1(cid.DagProtobuf, root.Cid().Hash())
+	r.AllowedRoots = cid.NewSet()
+	r.AllowedRoots.Add(root.Cid())
+
+	for _, p := range []string{
+		"/dms3fs/" + root.Cid().String() + "/v0",
+		"/dms3fs/" + root.Cid().String() + "/v1",
+		"/dms3fs/" + rootV1.String() + "/v0",
+		"/dms3fs/" + rootV1.String() + "/v1",
+	} {
+		nd, err := r.ResolvePath(ctx, path.FromString(p))
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+		if nd.Cid().KeyString() != leaf.Cid().KeyString() {
+			t.Fatalf("%s: expected %s, got %s", p, leaf.Cid(), nd.Cid())
+		}
+
+		changed, _, err := r.HasChanged(ctx, path.FromString(p), leafV1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed {
+			t.Fatalf("%s: expected no change against %s", p, leafV1)
+		}
+	}
+
+	selected, err := r.ResolveSelector(ctx, rootV1, resolver.SelectAll{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 {
+		t.Fatalf("expected the leaf to be selected once, got %d nodes", len(selected))
+	}
+}
+
+func TestOnLinkNotFound(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "remote", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asked []string
+	r.OnLinkNotFound = func(ctx context.Context, nd dms3ld.Node, name string) (*dms3ld.Link, error) {
+		asked = append(asked, name)
+		if name == "remote" && nd.Cid().Equals(nodes[0].Cid()) {
+			return &dms3ld.Link{Name: name, Cid: nodes[1].Cid()}, nil
+		}
+		return nil, nil
+	}
+
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+	if len(asked) != 1 {
+		t.Fatalf("expected the hook to be called once, got %v", asked)
+	}
+
+	p, err = path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ResolvePath(ctx, p)
+	if e, ok := err.(resolver.ErrNoLink); !ok || e.Name != "missing" {
+		t.Fatalf("expected ErrNoLink when the hook finds nothing, got %v", err)
+	}
+
+	hookErr := errors.New("index unavailable")
+	r.OnLinkNotFound = func(ctx context.Context, nd dms3ld.Node, name string) (*dms3ld.Link, error) {
+		return nil, hookErr
+	}
+	if _, err := r.ResolvePath(ctx, p); err != hookErr {
+		t.Fatalf("expected the error of the hook, got %v", err)
+	}
+}
+
+func TestSplitAtLeaf(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+
+	leaf := newMapNode(t, map[string]interface{}{"meta": "data"})
+	root := newMapNode(t, map[string]interface{}{"leaf": leaf.Cid(), "dir": nodes[1].Cid()})
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = extraGetter{dagService, []dms3ld.Node{root, leaf}}
+
+	base := path.FromCid(root.Cid()).String()
+	for _, tc := range []struct {
+		in       string
+		linkPath string
+		dataPath []string
+	}{
+		{base + "/leaf/meta", base + "/leaf", []string{"meta"}},
+		{base + "/leaf", base + "/leaf", nil},
+		{base + "/dir/grandchild", base + "/dir/grandchild", nil},
+		{base, base, nil},
+	} {
+		linkPath, dataPath, err := r.SplitAtLeaf(ctx, path.FromString(tc.in))
+		if err != nil {
+			t.Fatalf("%s: %s", tc.in, err)
+		}
+		if linkPath.String() != tc.linkPath || path.Join(dataPath) != path.Join(tc.dataPath) {
+			t.Fatalf("%s: expected %s and %v, got %s and %v", tc.in, tc.linkPath, tc.dataPath, linkPath, dataPath)
+		}
+	}
+
+	if _, _, err := r.SplitAtLeaf(ctx, path.FromString(base+"/leaf/missing")); err == nil {
+		t.Fatal("expected a missing field to fail")
+	}
+}
@@ -0,0 +1,197 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	dag "github.com/dms3-fs/go-merkledag"
+)
+
+// ErrInvalidSelector is returned by ResolveSelector for selectors which
+// can't be applied, like a SelectRange with a negative bound.
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// Selector describes a set of nodes of a DAG relative to a starting node,
+// for use with ResolveSelector. Only the subset of IPLD selectors needed for
+// common traversals is supported: SelectNode, SelectAll, SelectFields and
+// SelectRange, which can be combined. A nil Selector selects the node it is
+// applied to, like SelectNode.
+type Selector interface {
+	// walk calls w.emit for every node selected under nd.
+	walk(ctx context.Context, w *walker, nd dms3ld.Node) error
+}
+
+// SelectNode selects the node it is applied to.
+type SelectNode struct{}
+
+// SelectAll recursively selects the node it is applied to and every node
+// reachable from it, up to Depth links away. A Depth of 0 means no limit.
+// A node reachable through several links is walked once.
+type SelectAll struct {
+	Depth int
+}
+
+// SelectFields follows the links with the given names, resolved with the
+// ResolveOnce of the resolver, and applies the matching selector to each
+// linked node, in the order of the names. Names which don't exist are
+// skipped.
+type SelectFields map[string]Selector
+
+// SelectRange follows the links of the node at positions Start (inclusive)
+// to End (exclusive) and applies Next to each linked node. An End of 0 means
+// up to the last link. Negative bounds fail with ErrInvalidSelector.
+type SelectRange struct {
+	Start int
+	End   int
+	Next  Selector
+}
+
+// walker holds the state of a ResolveSelector walk.
+type walker struct {
+	r    *Resolver
+	emit func(dms3ld.Node)
+
+	// walked holds, by contentKey, the most links left to walk below each
+	// node SelectAll went through, -1 meaning no limit.
+	walked map[string]int
+}
+
+// ResolveSelector returns the nodes selected by sel, starting at the node
+// with the given cid. Every node is returned once, in the order it was
+// first selected, even when it is linked under both cid versions.
+func (r *Resolver) ResolveSelector(ctx context.Context, root *cid.Cid, sel Selector) ([]dms3ld.Node, error) {
+	if err := r.checkRoot(root); err != nil {
+		return nil, err
+	}
+
+	nd, err := r.getNode(ctx, root, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []dms3ld.Node
+	seen := make(map[string]bool)
+	w := &walker{
+		r: r,
+		emit: func(n dms3ld.Node) {
+			if k := contentKey(n.Cid()); !seen[k] {
+				seen[k] = true
+				out = append(out, n)
+			}
+		},
+		walked: make(map[string]int),
+	}
+	if err := w.walk(ctx, sel, nd); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// walk applies sel to nd.
+func (w *walker) walk(ctx context.Context, sel Selector, nd dms3ld.Node) error {
+	if sel == nil {
+		sel = SelectNode{}
+	}
+	return sel.walk(ctx, w, nd)
+}
+
+func (SelectNode) walk(ctx context.Context, w *walker, nd dms3ld.Node) error {
+	w.emit(nd)
+	return nil
+}
+
+func (s SelectAll) walk(ctx context.Context, w *walker, nd dms3ld.Node) error {
+	left := -1
+	if s.Depth > 0 {
+		left = s.Depth
+	}
+	if w.walkedAll(nd.Cid(), left) {
+		return nil
+	}
+	return w.walkAll(ctx, nd, left)
+}
+
+// walkAll selects nd and the nodes up to left links away from it, or all
+// of them when left is negative. Nodes already walked with as many links
+// left aren't fetched again.
+func (w *walker) walkAll(ctx context.Context, nd dms3ld.Node, left int) error {
+	w.walked[contentKey(nd.Cid())] = left
+	w.emit(nd)
+	if left == 0 {
+		return nil
+	}
+
+	for _, lnk := range nd.Links() {
+		if w.walkedAll(lnk.Cid, left-1) {
+			continue
+		}
+		child, err := w.r.getNode(ctx, lnk.Cid, nil)
+		if err != nil {
+			return err
+		}
+		if err := w.walkAll(ctx, child, left-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkedAll tells whether walkAll went through the node with cid c with at
+// least left links left.
+func (w *walker) walkedAll(c *cid.Cid, left int) bool {
+	prev, ok := w.walked[contentKey(c)]
+	return ok && (prev < 0 || left >= 0 && prev >= left)
+}
+
+func (s SelectFields) walk(ctx context.Context, w *walker, nd dms3ld.Node) error {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := w.r
+	for _, name := range names {
+		lnk, _, err := r.ResolveOnce(ctx, r.DAG, nd, []string{name})
+		if err == dag.ErrLinkNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		child, err := r.getNode(ctx, lnk.Cid, nil)
+		if err != nil {
+			return err
+		}
+		if err := w.walk(ctx, s[name], child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s SelectRange) walk(ctx context.Context, w *walker, nd dms3ld.Node) error {
+	if s.Start < 0 || s.End < 0 {
+		return ErrInvalidSelector
+	}
+
+	links := nd.Links()
+	end := s.End
+	if end == 0 || end > len(links) {
+		end = len(links)
+	}
+
+	for i := s.Start; i < end; i++ {
+		child, err := w.r.getNode(ctx, links[i].Cid, nil)
+		if err != nil {
+			return err
+		}
+		if err := w.walk(ctx, s.Next, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
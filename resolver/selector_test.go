@@ -0,0 +1,190 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dms3-fs/go-path/resolver"
+
+	dms3ld "github.com/dms3-fs/go-ld-format"
+	dagmock "github.com/dms3-fs/go-merkledag/test"
+)
+
+func assertSelected(t *testing.T, selected []dms3ld.Node, expected ...dms3ld.Node) {
+	if len(selected) != len(expected) {
+		t.Fatalf("expected %d nodes to be selected, got %d", len(expected), len(selected))
+	}
+	for i := range expected {
+		if !selected[i].Cid().Equals(expected[i].Cid()) {
+			t.Fatalf("expected node %d to be %s, got %s", i, expected[i].Cid(), selected[i].Cid())
+		}
+	}
+}
+
+func TestResolveSelector(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+	root := nodes[0].Cid()
+
+	all, err := r.ResolveSelector(ctx, root, resolver.SelectAll{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, all, nodes[0], nodes[1], nodes[2])
+
+	shallow, err := r.ResolveSelector(ctx, root, resolver.SelectAll{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, shallow, nodes[0], nodes[1])
+
+	deep, err := r.ResolveSelector(ctx, root, resolver.SelectAll{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, deep, nodes[0], nodes[1], nodes[2])
+
+	fields, err := r.ResolveSelector(ctx, root, resolver.SelectFields{
+		"child": resolver.SelectFields{
+			"grandchild": resolver.SelectNode{},
+			"missing":    resolver.SelectNode{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, fields, nodes[2])
+
+	// fields are followed in the order of their names
+	both := randNode()
+	if err := both.AddNodeLink("y", nodes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := both.AddNodeLink("x", nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.Add(ctx, both); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sorted, err := r.ResolveSelector(ctx, both.Cid(), resolver.SelectFields{
+			"y": resolver.SelectNode{},
+			"x": resolver.SelectNode{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSelected(t, sorted, nodes[2], nodes[1])
+	}
+
+	rng, err := r.ResolveSelector(ctx, root, resolver.SelectRange{Next: resolver.SelectAll{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, rng, nodes[1], nodes[2])
+}
+
+func TestResolveSelectorRepeatedSubtrees(t *testing.T) {
+	ctx := context.Background()
+	dagService := dagmock.Mock()
+
+	// a chain of nodes each linking twice to the next one, which walked
+	// naively takes 2^20 fetches
+	bottom := randNode()
+	if err := dagService.Add(ctx, bottom); err != nil {
+		t.Fatal(err)
+	}
+	top := bottom
+	for i := 0; i < 20; i++ {
+		nd := randNode()
+		for _, name := range []string{"a", "b"} {
+			if err := nd.AddNodeLink(name, top); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dagService.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		top = nd
+	}
+
+	getter := &gatedGetter{
+		NodeGetter: dagService,
+		gate:       make(chan struct{}),
+		fetches:    make(map[string]int),
+	}
+	close(getter.gate)
+	r := resolver.NewBasicResolver(dagService)
+	r.DAG = getter
+
+	all, err := r.ResolveSelector(ctx, top.Cid(), resolver.SelectAll{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 21 {
+		t.Fatalf("expected 21 nodes to be selected, got %d", len(all))
+	}
+	if f := getter.fetches[bottom.Cid().KeyString()]; f != 1 {
+		t.Fatalf("expected the bottom node to be fetched once, got %d fetches", f)
+	}
+
+	// a node first reached deep is walked again when reached higher up
+	s, u := randNode(), randNode()
+	if err := s.AddNodeLink("s", u); err != nil {
+		t.Fatal(err)
+	}
+	p := randNode()
+	if err := p.AddNodeLink("p", s); err != nil {
+		t.Fatal(err)
+	}
+	root := randNode()
+	if err := root.AddNodeLink("a", p); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("b", s); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []dms3ld.Node{u, s, p, root} {
+		if err := dagService.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shallow, err := r.ResolveSelector(ctx, root.Cid(), resolver.SelectAll{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, shallow, root, p, s, u)
+}
+
+func TestResolveSelectorNil(t *testing.T) {
+	ctx := context.Background()
+	dagService, nodes := newFixture(t)
+	r := resolver.NewBasicResolver(dagService)
+	root := nodes[0].Cid()
+
+	// nil selectors select the node they are applied to
+	selected, err := r.ResolveSelector(ctx, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, selected, nodes[0])
+
+	selected, err = r.ResolveSelector(ctx, root, resolver.SelectFields{"child": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, selected, nodes[1])
+
+	selected, err = r.ResolveSelector(ctx, root, resolver.SelectRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSelected(t, selected, nodes[1])
+
+	for _, sel := range []resolver.SelectRange{{Start: -1}, {End: -1}} {
+		if _, err := r.ResolveSelector(ctx, root, sel); err != resolver.ErrInvalidSelector {
+			t.Fatalf("expected %+v to fail with ErrInvalidSelector, got %v", sel, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package resolver
+
+import (
+	"context"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// NewTieredResolver constructs a basic resolver fetching every node from
+// primary first, then from each fallback in turn while the node isn't
+// found, e.g. from a local blockstore before a remote one.
+func NewTieredResolver(primary dms3ld.NodeGetter, fallbacks ...dms3ld.NodeGetter) *Resolver {
+	return &Resolver{
+		DAG:         tieredGetter(append([]dms3ld.NodeGetter{primary}, fallbacks...)),
+		ResolveOnce: ResolveSingle,
+	}
+}
+
+// tieredGetter is a NodeGetter trying its getters in order until one of
+// them has the requested node.
+type tieredGetter []dms3ld.NodeGetter
+
+func (tg tieredGetter) Get(ctx context.Context, c *cid.Cid) (dms3ld.Node, error) {
+	for _, g := range tg {
+		nd, err := g.Get(ctx, c)
+		if err != dms3ld.ErrNotFound {
+			return nd, err
+		}
+	}
+	return nil, dms3ld.ErrNotFound
+}
+
+func (tg tieredGetter) GetMany(ctx context.Context, cids []*cid.Cid) <-chan *dms3ld.NodeOption {
+	out := make(chan *dms3ld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			nd, err := tg.Get(ctx, c)
+			out <- &dms3ld.NodeOption{Node: nd, Err: err}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,51 @@
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	path "github.com/dms3-fs/go-path"
+	"github.com/dms3-fs/go-path/resolver"
+
+	cid "github.com/dms3-fs/go-cid"
+	dagmock "github.com/dms3-fs/go-merkledag/test"
+)
+
+func TestTieredResolver(t *testing.T) {
+	ctx := context.Background()
+	remote, nodes := newFixture(t)
+
+	// only the root is available locally
+	local := dagmock.Mock()
+	if err := local.Add(ctx, nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := path.FromSegments("/dms3fs/", nodes[0].Cid().String(), "child", "grandchild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resolver.NewBasicResolver(local).ResolvePath(ctx, p); err == nil {
+		t.Fatal("expected the local store alone not to be enough")
+	}
+
+	r := resolver.NewTieredResolver(local, remote)
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(nodes[2].Cid()) {
+		t.Fatalf("expected %s, got %s", nodes[2].Cid(), nd.Cid())
+	}
+
+	for opt := range r.DAG.GetMany(ctx, []*cid.Cid{nodes[0].Cid(), nodes[2].Cid()}) {
+		if opt.Err != nil {
+			t.Fatal(opt.Err)
+		}
+	}
+
+	if _, err := resolver.NewTieredResolver(local, dagmock.Mock()).ResolvePath(ctx, p); err == nil {
+		t.Fatal("expected resolution to fail when no store has the node")
+	}
+}
@@ -0,0 +1,139 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	cid "github.com/dms3-fs/go-cid"
+	dms3ld "github.com/dms3-fs/go-ld-format"
+)
+
+// ErrBadShard is returned when a HAMT sharded directory can't be read: a
+// link of a shard doesn't start with a bucket index, or an inner shard isn't
+// one.
+var ErrBadShard = errors.New("invalid HAMT shard")
+
+// Types of UnixFS nodes, from the Type field of their data.
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsMetadata  = 3
+	unixfsSymlink   = 4
+	unixfsHAMTShard = 5
+)
+
+// unixfsData holds the fields of the UnixFS data of a node this package
+// uses.
+type unixfsData struct {
+	Type   uint64
+	Data   []byte
+	Fanout uint64
+}
+
+// decodeUnixFS decodes the UnixFS data of nd, the protobuf Data message held
+// in the data of dag-pb nodes. The message is small enough to be read by
+// hand, which saves a dependency on the unixfs package. ok is false when nd
+// isn't a dag-pb node or its data isn't a UnixFS Data message.
+func decodeUnixFS(nd dms3ld.Node) (d unixfsData, ok bool) {
+	pn, isPB := nd.(interface {
+		Data() []byte
+	})
+	if !isPB || nd.Cid().Type() != cid.DagProtobuf {
+		return d, false
+	}
+
+	b := pn.Data()
+	hasType := false
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return d, false
+		}
+		b = b[n:]
+
+		var v uint64
+		var bytes []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return d, false
+			}
+			b = b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return d, false
+			}
+			bytes, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return d, false
+		}
+
+		// only the fields of the Data message, with their wire types
+		switch key {
+		case 1 << 3:
+			d.Type, hasType = v, true
+		case 2<<3 | 2:
+			d.Data = bytes
+		case 6 << 3:
+			d.Fanout = v
+		case 3 << 3, 4 << 3, 4<<3 | 2, 5 << 3, 7 << 3, 8<<3 | 2:
+			// filesize, blocksizes, hashType, mode and mtime
+		default:
+			return d, false
+		}
+	}
+	return d, hasType && d.Type <= unixfsHAMTShard
+}
+
+// dirEntries returns the entries of the directory nd: its links or, for a
+// HAMT sharded directory, the links held in all of its shards, under the
+// names of the entries. They are sorted by name when SortEntries is set.
+// Only the inner shards are fetched, not the entries.
+func (r *Resolver) dirEntries(ctx context.Context, nd dms3ld.Node) ([]*dms3ld.Link, error) {
+	links := nd.Links()
+	if d, ok := decodeUnixFS(nd); ok && d.Type == unixfsHAMTShard {
+		var err error
+		links, err = r.shardEntries(ctx, nd, d.Fanout, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.entries(links), nil
+}
+
+// shardEntries appends the entries held in the HAMT shard nd to out. The
+// names of the links of a shard start with the hex index of their bucket,
+// which makes up the whole name of the links to inner shards.
+func (r *Resolver) shardEntries(ctx context.Context, nd dms3ld.Node, fanout uint64, out []*dms3ld.Link) ([]*dms3ld.Link, error) {
+	if fanout == 0 {
+		return nil, ErrBadShard
+	}
+	width := len(fmt.Sprintf("%X", fanout-1))
+
+	for _, lnk := range nd.Links() {
+		switch {
+		case len(lnk.Name) < width:
+			return nil, ErrBadShard
+		case len(lnk.Name) == width:
+			child, err := r.getNode(ctx, lnk.Cid, nil)
+			if err != nil {
+				return nil, err
+			}
+			d, ok := decodeUnixFS(child)
+			if !ok || d.Type != unixfsHAMTShard {
+				return nil, ErrBadShard
+			}
+			out, err = r.shardEntries(ctx, child, d.Fanout, out)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			out = append(out, &dms3ld.Link{Name: lnk.Name[width:], Size: lnk.Size, Cid: lnk.Cid})
+		}
+	}
+	return out, nil
+}